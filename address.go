@@ -3,10 +3,22 @@
 
 package rollmelette
 
-import "github.com/ethereum/go-ethereum/common"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
+)
 
 // AddressBook contains the addresses of the rollups contracts.
 type AddressBook struct {
+	AppAddressRelay              common.Address
 	ApplicationFactory           common.Address
 	AuthorityFactory             common.Address
 	ERC1155BatchPortal           common.Address
@@ -19,6 +31,9 @@ type AddressBook struct {
 	TestToken                    common.Address
 	TestNFT                      common.Address
 	TestMultiToken               common.Address
+
+	// PortalLayout is the layout of the payload sent by the portals.
+	PortalLayout PortalLayout
 }
 
 // NewAddressBook returns the contract addresses for mainnet and devnet.
@@ -38,3 +53,258 @@ func NewAddressBook() AddressBook {
 		TestMultiToken:               common.HexToAddress("0xDC6d64971B77a47fB3E3c6c409D4A05468C398D2"),
 	}
 }
+
+// newAddressBookV1 returns the contract addresses of the rollups contracts v1.4.
+func newAddressBookV1() AddressBook {
+	return AddressBook{
+		AppAddressRelay:     common.HexToAddress("0xF5DE34d6BbC0446E2a45719E718efEbaaE179daE"),
+		ApplicationFactory:  common.HexToAddress("0x7122cd1221C20892234186facfE8615e6743Ab02"),
+		ERC1155BatchPortal:  common.HexToAddress("0xedB53860A6B52bbb7561Ad596416ee9965B055Aa"),
+		ERC1155SinglePortal: common.HexToAddress("0x7CFB0193Ca87eB6e48056885E026552c3A941FC4"),
+		ERC20Portal:         common.HexToAddress("0x9C21AEb2093C32DDbC53eEF24B873BDCd1aDa1DB"),
+		ERC721Portal:        common.HexToAddress("0x237F8DD094C0e47f4236f12b4Fa01d6Dae89fb87"),
+		EtherPortal:         common.HexToAddress("0xFfdbe43d4c855BF7e0f105c400A50857f53AB044"),
+		InputBox:            common.HexToAddress("0x59b22D57D4f067708AB0c00552767405926dc768"),
+		PortalLayout:        PortalLayoutV1,
+	}
+}
+
+// withoutTestContracts returns a copy of the address book without the devnet test contracts.
+func (b AddressBook) withoutTestContracts() AddressBook {
+	b.TestToken = common.Address{}
+	b.TestNFT = common.Address{}
+	b.TestMultiToken = common.Address{}
+	return b
+}
+
+// addressBookPresets maps the preset names to the functions that create them.
+// The names without the release prefix refer to the latest release of the rollups contracts.
+var addressBookPresets = map[string]func() AddressBook{
+	"devnet":     NewAddressBook,
+	"sepolia":    func() AddressBook { return NewAddressBook().withoutTestContracts() },
+	"mainnet":    func() AddressBook { return NewAddressBook().withoutTestContracts() },
+	"v2/devnet":  NewAddressBook,
+	"v2/sepolia": func() AddressBook { return NewAddressBook().withoutTestContracts() },
+	"v2/mainnet": func() AddressBook { return NewAddressBook().withoutTestContracts() },
+	"v1/devnet":  newAddressBookV1,
+	"v1/sepolia": newAddressBookV1,
+	"v1/mainnet": newAddressBookV1,
+}
+
+// AddressBookPresets returns the names of the address book presets.
+func AddressBookPresets() []string {
+	var names []string
+	for name := range addressBookPresets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// NewAddressBookPreset returns the address book with the given preset name.
+// The preset name has the format "network" or "release/network"; for instance, "sepolia" or
+// "v1/mainnet".
+func NewAddressBookPreset(name string) (AddressBook, error) {
+	preset, ok := addressBookPresets[name]
+	if !ok {
+		return AddressBook{}, fmt.Errorf("address book: preset not found: %v", name)
+	}
+	return preset(), nil
+}
+
+// LoadAddressBook loads the address book from a JSON or TOML deployment file.
+// Files with the .toml extension are decoded as TOML; the other files are decoded as JSON.
+// The file may map the contract names to addresses, or contain a "contracts" object that maps
+// the contract names to objects with an "address" field. The contract names are the names of
+// the AddressBook fields or the names of the contracts in the rollups deployment. The file may
+// also contain a "portalLayout" field. Unknown contracts are ignored.
+func LoadAddressBook(path string) (AddressBook, error) {
+	return loadAddressBookFile(AddressBook{}, path)
+}
+
+// loadAddressBookFile overrides the given book with the addresses in the deployment file.
+func loadAddressBookFile(book AddressBook, path string) (AddressBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return book, fmt.Errorf("address book: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		if data, err = tomlToJSON(data); err != nil {
+			return book, fmt.Errorf("address book: decode %v: %w", path, err)
+		}
+	}
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(data, &file); err != nil {
+		return book, fmt.Errorf("address book: decode %v: %w", path, err)
+	}
+	if rawLayout, ok := file["portalLayout"]; ok {
+		var name string
+		if err := json.Unmarshal(rawLayout, &name); err != nil {
+			return book, fmt.Errorf("address book: decode portalLayout: %w", err)
+		}
+		if book.PortalLayout, err = ParsePortalLayout(name); err != nil {
+			return book, fmt.Errorf("address book: %w", err)
+		}
+	}
+	contracts := file
+	if rawContracts, ok := file["contracts"]; ok {
+		if err := json.Unmarshal(rawContracts, &contracts); err != nil {
+			return book, fmt.Errorf("address book: decode contracts: %w", err)
+		}
+	}
+	for _, field := range addressBookFields {
+		for _, name := range field.names {
+			raw, ok := contracts[name]
+			if !ok {
+				continue
+			}
+			address, err := decodeDeploymentAddress(raw)
+			if err != nil {
+				return book, fmt.Errorf("address book: decode %v: %w", name, err)
+			}
+			*field.address(&book) = address
+		}
+	}
+	return book, nil
+}
+
+// LoadAddressBookEnv overrides the addresses in the given book with the addresses set in the
+// environment variables. The variables have the ROLLMELETTE_ prefix followed by the field name
+// in upper snake case; for instance, ROLLMELETTE_ERC20_PORTAL.
+func LoadAddressBookEnv(book AddressBook) (AddressBook, error) {
+	for _, field := range addressBookFields {
+		value, ok := os.LookupEnv(field.env)
+		if !ok {
+			continue
+		}
+		if !common.IsHexAddress(value) {
+			return book, fmt.Errorf("address book: invalid address in %v: %v", field.env, value)
+		}
+		*field.address(&book) = common.HexToAddress(value)
+	}
+	return book, nil
+}
+
+// Validate returns an error if the addresses required by Rollmelette are missing.
+func (b AddressBook) Validate() error {
+	var errs []error
+	for _, field := range addressBookFields {
+		if field.required && *field.address(&b) == (common.Address{}) {
+			errs = append(errs, fmt.Errorf("address book: missing %v address", field.names[0]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addressBookField describes an address field of the address book.
+type addressBookField struct {
+	// names of the contract in the deployment files; the first one is the field name
+	names []string
+
+	// env is the environment variable that overrides the address
+	env string
+
+	// required is true if Rollmelette can't run without the address
+	required bool
+
+	// address returns a pointer to the field
+	address func(b *AddressBook) *common.Address
+}
+
+var addressBookFields = []addressBookField{
+	{
+		names:   []string{"AppAddressRelay", "DAppAddressRelay"},
+		env:     "ROLLMELETTE_APP_ADDRESS_RELAY",
+		address: func(b *AddressBook) *common.Address { return &b.AppAddressRelay },
+	},
+	{
+		names:   []string{"ApplicationFactory", "CartesiDAppFactory"},
+		env:     "ROLLMELETTE_APPLICATION_FACTORY",
+		address: func(b *AddressBook) *common.Address { return &b.ApplicationFactory },
+	},
+	{
+		names:   []string{"AuthorityFactory"},
+		env:     "ROLLMELETTE_AUTHORITY_FACTORY",
+		address: func(b *AddressBook) *common.Address { return &b.AuthorityFactory },
+	},
+	{
+		names:   []string{"ERC1155BatchPortal"},
+		env:     "ROLLMELETTE_ERC1155_BATCH_PORTAL",
+		address: func(b *AddressBook) *common.Address { return &b.ERC1155BatchPortal },
+	},
+	{
+		names:   []string{"ERC1155SinglePortal"},
+		env:     "ROLLMELETTE_ERC1155_SINGLE_PORTAL",
+		address: func(b *AddressBook) *common.Address { return &b.ERC1155SinglePortal },
+	},
+	{
+		names:    []string{"ERC20Portal"},
+		env:      "ROLLMELETTE_ERC20_PORTAL",
+		required: true,
+		address:  func(b *AddressBook) *common.Address { return &b.ERC20Portal },
+	},
+	{
+		names:   []string{"ERC721Portal"},
+		env:     "ROLLMELETTE_ERC721_PORTAL",
+		address: func(b *AddressBook) *common.Address { return &b.ERC721Portal },
+	},
+	{
+		names:    []string{"EtherPortal"},
+		env:      "ROLLMELETTE_ETHER_PORTAL",
+		required: true,
+		address:  func(b *AddressBook) *common.Address { return &b.EtherPortal },
+	},
+	{
+		names:   []string{"InputBox"},
+		env:     "ROLLMELETTE_INPUT_BOX",
+		address: func(b *AddressBook) *common.Address { return &b.InputBox },
+	},
+	{
+		names:   []string{"SelfHostedApplicationFactory"},
+		env:     "ROLLMELETTE_SELF_HOSTED_APPLICATION_FACTORY",
+		address: func(b *AddressBook) *common.Address { return &b.SelfHostedApplicationFactory },
+	},
+	{
+		names:   []string{"TestToken"},
+		env:     "ROLLMELETTE_TEST_TOKEN",
+		address: func(b *AddressBook) *common.Address { return &b.TestToken },
+	},
+	{
+		names:   []string{"TestNFT"},
+		env:     "ROLLMELETTE_TEST_NFT",
+		address: func(b *AddressBook) *common.Address { return &b.TestNFT },
+	},
+	{
+		names:   []string{"TestMultiToken"},
+		env:     "ROLLMELETTE_TEST_MULTI_TOKEN",
+		address: func(b *AddressBook) *common.Address { return &b.TestMultiToken },
+	},
+}
+
+// decodeDeploymentAddress decodes an address from a deployment file.
+// The address may be a string or an object with the address field.
+func decodeDeploymentAddress(raw json.RawMessage) (common.Address, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		var contract struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(raw, &contract); err != nil {
+			return common.Address{}, err
+		}
+		value = contract.Address
+	}
+	if !common.IsHexAddress(value) {
+		return common.Address{}, fmt.Errorf("invalid address: %v", value)
+	}
+	return common.HexToAddress(value), nil
+}
+
+// tomlToJSON converts a TOML document to JSON, so the deployment files share the JSON decoder.
+func tomlToJSON(data []byte) ([]byte, error) {
+	var document map[string]any
+	if err := toml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestAddressBookSuite(t *testing.T) {
+	suite.Run(t, new(AddressBookSuite))
+}
+
+type AddressBookSuite struct {
+	suite.Suite
+	address common.Address
+}
+
+func (s *AddressBookSuite) SetupTest() {
+	s.address = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *AddressBookSuite) writeFile(content string) string {
+	return s.writeFileNamed("deployment.json", content)
+}
+
+func (s *AddressBookSuite) writeFileNamed(name string, content string) string {
+	path := filepath.Join(s.T().TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	s.Require().Nil(err)
+	return path
+}
+
+func (s *AddressBookSuite) TestPresets() {
+	for _, name := range AddressBookPresets() {
+		book, err := NewAddressBookPreset(name)
+		s.Nil(err)
+		s.Nilf(book.Validate(), "preset %v", name)
+	}
+
+	devnet, err := NewAddressBookPreset("devnet")
+	s.Require().Nil(err)
+	s.Equal(NewAddressBook(), devnet)
+
+	mainnet, err := NewAddressBookPreset("mainnet")
+	s.Require().Nil(err)
+	s.Equal(NewAddressBook().ERC20Portal, mainnet.ERC20Portal)
+	s.Equal(common.Address{}, mainnet.TestToken)
+
+	v1, err := NewAddressBookPreset("v1/sepolia")
+	s.Require().Nil(err)
+	s.Equal(PortalLayoutV1, v1.PortalLayout)
+	s.NotEqual(common.Address{}, v1.AppAddressRelay)
+
+	_, err = NewAddressBookPreset("v3/mainnet")
+	s.ErrorContains(err, "preset not found: v3/mainnet")
+}
+
+func (s *AddressBookSuite) TestLoadDeploymentFile() {
+	path := s.writeFile(`{
+		"name": "localhost",
+		"chainId": "31337",
+		"contracts": {
+			"InputBox": {"address": "0xfafafafafafafafafafafafafafafafafafafafa", "abi": []},
+			"DAppAddressRelay": {"address": "0xfafafafafafafafafafafafafafafafafafafafa"},
+			"UnknownContract": {"address": "0xfefefefefefefefefefefefefefefefefefefefe"}
+		}
+	}`)
+	book, err := LoadAddressBook(path)
+	s.Require().Nil(err)
+	s.Equal(s.address, book.InputBox)
+	s.Equal(s.address, book.AppAddressRelay)
+	s.Equal(common.Address{}, book.EtherPortal)
+}
+
+func (s *AddressBookSuite) TestLoadFlatFile() {
+	path := s.writeFile(`{
+		"EtherPortal": "0xfafafafafafafafafafafafafafafafafafafafa",
+		"ERC20Portal": "0xfafafafafafafafafafafafafafafafafafafafa",
+		"portalLayout": "layer-data"
+	}`)
+	book, err := LoadAddressBook(path)
+	s.Require().Nil(err)
+	s.Equal(s.address, book.EtherPortal)
+	s.Equal(s.address, book.ERC20Portal)
+	s.Equal(PortalLayoutLayerData, book.PortalLayout)
+	s.Nil(book.Validate())
+}
+
+func (s *AddressBookSuite) TestLoadTOMLFile() {
+	path := s.writeFileNamed("deployment.toml", `
+		portalLayout = "v1"
+
+		[contracts.ERC20Portal]
+		address = "0xfafafafafafafafafafafafafafafafafafafafa"
+	`)
+	book, err := LoadAddressBook(path)
+	s.Require().Nil(err)
+	s.Equal(PortalLayoutV1, book.PortalLayout)
+	s.Equal(s.address, book.ERC20Portal)
+
+	path = s.writeFileNamed("deployment.toml", `EtherPortal = `)
+	_, err = LoadAddressBook(path)
+	s.ErrorContains(err, "address book: decode "+path)
+}
+
+func (s *AddressBookSuite) TestLoadInvalidFile() {
+	path := s.writeFile(`{"EtherPortal": "0xfafa"}`)
+	_, err := LoadAddressBook(path)
+	s.ErrorContains(err, "address book: decode EtherPortal: invalid address: 0xfafa")
+
+	path = s.writeFile(`{"portalLayout": "v3"}`)
+	_, err = LoadAddressBook(path)
+	s.ErrorContains(err, "invalid portal layout: v3")
+
+	_, err = LoadAddressBook(filepath.Join(s.T().TempDir(), "missing.json"))
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *AddressBookSuite) TestLoadEnv() {
+	s.T().Setenv("ROLLMELETTE_ERC20_PORTAL", s.address.String())
+	book, err := LoadAddressBookEnv(NewAddressBook())
+	s.Require().Nil(err)
+	s.Equal(s.address, book.ERC20Portal)
+	s.Equal(NewAddressBook().EtherPortal, book.EtherPortal)
+
+	s.T().Setenv("ROLLMELETTE_ETHER_PORTAL", "invalid")
+	_, err = LoadAddressBookEnv(NewAddressBook())
+	s.ErrorContains(err, "invalid address in ROLLMELETTE_ETHER_PORTAL: invalid")
+}
+
+func (s *AddressBookSuite) TestValidate() {
+	var book AddressBook
+	err := book.Validate()
+	s.ErrorContains(err, "address book: missing ERC20Portal address")
+	s.ErrorContains(err, "address book: missing EtherPortal address")
+}
+
+func (s *AddressBookSuite) TestRunValidatesAddressBook() {
+	opts := NewRunOpts()
+	opts.EtherPortal = common.Address{}
+	err := Run(context.Background(), opts, new(testApplication))
+	s.ErrorContains(err, "address book: missing EtherPortal address")
+}
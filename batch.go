@@ -0,0 +1,258 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Transfer is a leg of a batch transfer.
+type Transfer struct {
+	// Asset is the ERC20 or native token address, or the zero address for Ether.
+	Asset common.Address
+
+	// Src is the account that sends the funds.
+	Src common.Address
+
+	// Dst is the account that receives the funds.
+	Dst common.Address
+
+	// Value is the amount transferred.
+	Value *big.Int
+}
+
+// Withdrawal is a leg of a batch withdrawal.
+type Withdrawal struct {
+	// Asset is the ERC20 or native token address, or the zero address for Ether.
+	Asset common.Address
+
+	// Account is the account whose balance is debited.
+	Account common.Address
+
+	// Recipient is the base-layer account that receives the funds.
+	Recipient common.Address
+
+	// Value is the amount withdrawn.
+	Value *big.Int
+}
+
+// batchKey identifies a balance touched by a batch transfer.
+type batchKey struct {
+	asset   common.Address
+	account common.Address
+}
+
+// batchBalances saves the balances touched by a batch and the fees it collected, so they can be
+// restored if the batch fails.
+type batchBalances struct {
+	env       *env
+	balances  map[batchKey]*big.Int
+	touched   []batchKey
+	collected int
+}
+
+func (e *env) newBatchBalances() *batchBalances {
+	return &batchBalances{
+		env:       e,
+		balances:  make(map[batchKey]*big.Int),
+		collected: len(e.collected),
+	}
+}
+
+// save saves the balance of the account and of the treasury, which receives the fees.
+func (b *batchBalances) save(asset common.Address, account common.Address) {
+	for _, account := range []common.Address{account, b.env.fees.Treasury} {
+		key := batchKey{asset, account}
+		if _, ok := b.balances[key]; !ok {
+			b.balances[key] = new(big.Int).Set(b.env.assetBalanceOf(asset, account))
+			b.touched = append(b.touched, key)
+		}
+	}
+}
+
+// restore restores the saved balances and drops the fees collected by the batch.
+func (b *batchBalances) restore() {
+	for _, key := range b.touched {
+		b.env.setAssetBalance(key.asset, key.account, b.balances[key])
+	}
+	b.env.collected = b.env.collected[:b.collected]
+}
+
+// batchTransfer applies the transfers in order, charging the transfer fees like EtherTransfer
+// and ERC20Transfer. If a transfer fails, it restores the balances changed by the previous
+// transfers and their fees.
+func (e *env) batchTransfer(transfers []Transfer) error {
+	saved := e.newBatchBalances()
+	for i, transfer := range transfers {
+		saved.save(transfer.Asset, transfer.Src)
+		saved.save(transfer.Asset, transfer.Dst)
+		if err := e.assetTransfer(transfer); err != nil {
+			saved.restore()
+			return &BatchTransferError{Leg: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// payout is a voucher of a batch withdrawal that aggregates the withdrawals of the same asset to
+// the same recipient.
+type payout struct {
+	asset     common.Address
+	recipient common.Address
+	value     *big.Int
+}
+
+// batchVoucher is the voucher that sends a payout.
+type batchVoucher struct {
+	destination common.Address
+	value       *big.Int
+	payload     []byte
+}
+
+// batchWithdraw debits the withdrawals in order and sends a voucher for each payout.
+// If a withdrawal fails or a voucher exceeds the output limits, it restores the balances debited
+// by the batch and sends no voucher. If the Rollup API fails after a voucher was sent, it panics,
+// which rejects the input.
+func (e *env) batchWithdraw(withdrawals []Withdrawal) ([]int, error) {
+	saved := e.newBatchBalances()
+	supplies := make(map[common.Address]*big.Int)
+	restore := func() {
+		saved.restore()
+		for token, supply := range supplies {
+			e.native.setSupply(token, supply)
+		}
+	}
+
+	var payouts []*payout
+	open := make(map[batchKey]*payout)
+	for i, withdrawal := range withdrawals {
+		saved.save(withdrawal.Asset, withdrawal.Account)
+		if _, ok := supplies[withdrawal.Asset]; !ok && e.isNativeToken(withdrawal.Asset) {
+			// burning changes the supply of native tokens
+			supplies[withdrawal.Asset] = e.native.totalSupply(withdrawal.Asset)
+		}
+		value, err := e.assetWithdraw(withdrawal)
+		if err != nil {
+			restore()
+			return nil, &BatchTransferError{Leg: i, Err: err}
+		}
+
+		// start a new payout if the aggregated value doesn't fit in a uint256
+		payoutKey := batchKey{withdrawal.Asset, withdrawal.Recipient}
+		p, ok := open[payoutKey]
+		if !ok || new(big.Int).Add(p.value, value).Cmp(MaxUint256) > 0 {
+			p = &payout{asset: withdrawal.Asset, recipient: withdrawal.Recipient, value: new(big.Int)}
+			open[payoutKey] = p
+			payouts = append(payouts, p)
+		}
+		p.value.Add(p.value, value)
+	}
+
+	// check the limits of every payout before sending any of them
+	vouchers := make([]batchVoucher, len(payouts))
+	for i, p := range payouts {
+		vouchers[i] = e.payoutVoucher(p)
+		if err := e.limits.check(LogRouteVoucher, e.outputs+i, vouchers[i].payload); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+
+	indices := make([]int, len(vouchers))
+	for i, v := range vouchers {
+		index, err := e.TryVoucher(v.destination, v.value, v.payload)
+		if err != nil {
+			restore()
+			if i > 0 {
+				// the previous payouts were sent, so the input must be rejected
+				panic(err)
+			}
+			return nil, err
+		}
+		indices[i] = index
+	}
+	return indices, nil
+}
+
+// assetWithdraw debits the withdrawal from the wallet that manages the asset and returns the
+// value paid out. The Ether and ERC20 withdrawals pay the withdrawal fee.
+func (e *env) assetWithdraw(w Withdrawal) (*big.Int, error) {
+	switch {
+	case w.Asset == (common.Address{}):
+		if err := e.checkEtherVoucher(); err != nil {
+			return nil, err
+		}
+		if err := e.etherWallet.withdraw(w.Account, w.Value); err != nil {
+			return nil, err
+		}
+	case e.isNativeToken(w.Asset):
+		_, _, err := e.native.withdraw(w.Asset, w.Account, w.Recipient, w.Value)
+		return w.Value, err
+	default:
+		if _, err := e.erc20Wallet.withdraw(w.Asset, w.Account, w.Recipient, w.Value); err != nil {
+			return nil, err
+		}
+	}
+	return e.withdrawFee(w.Asset, w.Account, w.Value)
+}
+
+// payoutVoucher returns the voucher that sends the payout.
+func (e *env) payoutVoucher(p *payout) batchVoucher {
+	switch {
+	case p.asset == (common.Address{}):
+		destination, value, payload := etherVoucher(e.PortalLayout, e.appAddress, p.recipient, p.value)
+		return batchVoucher{destination, value, payload}
+	case e.isNativeToken(p.asset):
+		token, _ := e.native.token(p.asset)
+		return batchVoucher{token.Minter, big.NewInt(0), encodeNativeWithdraw(p.recipient, p.value)}
+	default:
+		return batchVoucher{p.asset, big.NewInt(0), encodeERC20Withdraw(p.recipient, p.value)}
+	}
+}
+
+// assetTransfer transfers the asset with the wallet that manages it.
+// The Ether and ERC20 transfers pay the transfer fee.
+func (e *env) assetTransfer(t Transfer) error {
+	switch {
+	case t.Asset == (common.Address{}):
+		return e.transferWithFee(t, func() error {
+			return e.etherWallet.transfer(t.Src, t.Dst, t.Value)
+		})
+	case e.isNativeToken(t.Asset):
+		return e.native.transfer(t.Asset, t.Src, t.Dst, t.Value)
+	default:
+		return e.transferWithFee(t, func() error {
+			return e.erc20Wallet.transfer(t.Asset, t.Src, t.Dst, t.Value)
+		})
+	}
+}
+
+func (e *env) assetBalanceOf(asset common.Address, account common.Address) *big.Int {
+	switch {
+	case asset == (common.Address{}):
+		return e.etherWallet.balanceOf(account)
+	case e.isNativeToken(asset):
+		return e.native.balance.balanceOf(asset, account)
+	default:
+		return e.erc20Wallet.balanceOf(asset, account)
+	}
+}
+
+func (e *env) setAssetBalance(asset common.Address, account common.Address, value *big.Int) {
+	switch {
+	case asset == (common.Address{}):
+		e.etherWallet.setBalance(account, value)
+	case e.isNativeToken(asset):
+		e.native.balance.setBalance(asset, account, value)
+	default:
+		e.erc20Wallet.setBalance(asset, account, value)
+	}
+}
+
+func (e *env) isNativeToken(asset common.Address) bool {
+	_, err := e.native.token(asset)
+	return err == nil
+}
@@ -0,0 +1,280 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestBatchTransferSuite(t *testing.T) {
+	suite.Run(t, new(BatchTransferSuite))
+}
+
+type BatchTransferSuite struct {
+	suite.Suite
+	env    *env
+	token  common.Address
+	points common.Address
+	alice  common.Address
+	bob    common.Address
+}
+
+func (s *BatchTransferSuite) SetupTest() {
+	s.env = NewTester(new(testApplication)).env
+	s.token = common.HexToAddress("0xbabababababababababababababababababababa")
+	s.alice = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.bob = common.HexToAddress("0xfefefefefefefefefefefefefefefefefefefefe")
+	var err error
+	s.points, err = s.env.NativeCreate(NativeToken{Name: "Points", Symbol: "PTS"})
+	s.Require().Nil(err)
+
+	s.env.SetEtherBalance(s.alice, big.NewInt(100))
+	s.env.SetERC20Balance(s.token, s.bob, big.NewInt(50))
+	s.Require().Nil(s.env.NativeMint(s.points, s.alice, big.NewInt(10)))
+}
+
+func (s *BatchTransferSuite) TestTrade() {
+	err := s.env.BatchTransfer([]Transfer{
+		{Asset: common.Address{}, Src: s.alice, Dst: s.bob, Value: big.NewInt(60)},
+		{Asset: s.token, Src: s.bob, Dst: s.alice, Value: big.NewInt(50)},
+		{Asset: s.points, Src: s.alice, Dst: s.bob, Value: big.NewInt(10)},
+	})
+	s.Nil(err)
+	s.Equal(big.NewInt(40), s.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(60), s.env.EtherBalanceOf(s.bob))
+	s.Equal(big.NewInt(50), s.env.ERC20BalanceOf(s.token, s.alice))
+	s.Equal(big.NewInt(0), s.env.ERC20BalanceOf(s.token, s.bob))
+	s.Equal(big.NewInt(10), s.env.NativeBalanceOf(s.points, s.bob))
+}
+
+func (s *BatchTransferSuite) TestFailingLeg() {
+	err := s.env.BatchTransfer([]Transfer{
+		{Asset: common.Address{}, Src: s.alice, Dst: s.bob, Value: big.NewInt(60)},
+		{Asset: s.points, Src: s.alice, Dst: s.bob, Value: big.NewInt(10)},
+		{Asset: s.token, Src: s.bob, Dst: s.alice, Value: big.NewInt(51)},
+	})
+	var batchErr *BatchTransferError
+	s.Require().ErrorAs(err, &batchErr)
+	s.Equal(2, batchErr.Leg)
+	s.ErrorIs(err, ErrInsufficientFunds)
+	s.ErrorContains(err, "batch transfer leg 2: insufficient funds")
+
+	// the previous legs are reverted
+	s.Equal(big.NewInt(100), s.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(0), s.env.EtherBalanceOf(s.bob))
+	s.Equal([]common.Address{s.alice}, s.env.EtherAddresses())
+	s.Equal(big.NewInt(10), s.env.NativeBalanceOf(s.points, s.alice))
+	s.Equal(big.NewInt(0), s.env.NativeBalanceOf(s.points, s.bob))
+	s.Equal(big.NewInt(50), s.env.ERC20BalanceOf(s.token, s.bob))
+}
+
+func (s *BatchTransferSuite) TestSameAccountTwice() {
+	err := s.env.BatchTransfer([]Transfer{
+		{Asset: common.Address{}, Src: s.alice, Dst: s.bob, Value: big.NewInt(60)},
+		{Asset: common.Address{}, Src: s.bob, Dst: s.alice, Value: big.NewInt(10)},
+		{Asset: common.Address{}, Src: s.alice, Dst: s.bob, Value: nil},
+	})
+	s.ErrorIs(err, ErrInvalidValue)
+	s.Equal(big.NewInt(100), s.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(0), s.env.EtherBalanceOf(s.bob))
+}
+
+func (s *BatchTransferSuite) TestLockedFunds() {
+	s.Require().Nil(s.env.EtherLock(s.alice, big.NewInt(50), "auction"))
+	err := s.env.BatchTransfer([]Transfer{
+		{Asset: common.Address{}, Src: s.alice, Dst: s.bob, Value: big.NewInt(51)},
+	})
+	s.ErrorIs(err, ErrInsufficientFunds)
+}
+
+func TestBatchWithdrawSuite(t *testing.T) {
+	suite.Run(t, new(BatchWithdrawSuite))
+}
+
+type BatchWithdrawSuite struct {
+	suite.Suite
+	app         *testApplication
+	tester      *Tester
+	withdrawals []Withdrawal
+	indices     []int
+	appAddress  common.Address
+	token       common.Address
+	minter      common.Address
+	alice       common.Address
+	bob         common.Address
+}
+
+func (s *BatchWithdrawSuite) SetupTest() {
+	s.appAddress = common.HexToAddress("0xab7528bb862fb57e8a2bcd567a2e929a0be56a5e")
+	s.token = common.HexToAddress("0xbabababababababababababababababababababa")
+	s.minter = common.HexToAddress("0xcacacacacacacacacacacacacacacacacacacaca")
+	s.alice = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.bob = common.HexToAddress("0xfefefefefefefefefefefefefefefefefefefefe")
+	s.app = &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			if deposit != nil {
+				return nil
+			}
+			var err error
+			s.indices, err = env.BatchWithdraw(s.withdrawals)
+			return err
+		},
+	}
+	opts := NewTesterOpts()
+	opts.AppAddress = s.appAddress
+	s.tester = NewTesterWithOpts(s.app, opts)
+	s.Require().Nil(s.tester.DepositEther(s.alice, big.NewInt(100), nil).Err)
+	s.Require().Nil(s.tester.DepositEther(s.bob, big.NewInt(100), nil).Err)
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(50), nil).Err)
+}
+
+func (s *BatchWithdrawSuite) TestAggregatePayouts() {
+	s.withdrawals = []Withdrawal{
+		{Asset: common.Address{}, Account: s.alice, Recipient: s.bob, Value: big.NewInt(30)},
+		{Asset: s.token, Account: s.alice, Recipient: s.alice, Value: big.NewInt(20)},
+		{Asset: common.Address{}, Account: s.bob, Recipient: s.bob, Value: big.NewInt(40)},
+		{Asset: s.token, Account: s.alice, Recipient: s.alice, Value: big.NewInt(5)},
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Equal([]int{0, 1}, s.indices)
+	s.Require().Len(result.Vouchers, 2)
+	s.Equal(s.bob, result.Vouchers[0].Destination)
+	s.Equal(big.NewInt(70), result.Vouchers[0].Value)
+	s.Empty(result.Vouchers[0].Payload)
+	s.Equal(s.token, result.Vouchers[1].Destination)
+	s.Equal(encodeERC20Withdraw(s.alice, big.NewInt(25)), result.Vouchers[1].Payload)
+
+	s.Equal(big.NewInt(70), s.tester.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(60), s.tester.env.EtherBalanceOf(s.bob))
+	s.Equal(big.NewInt(25), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+}
+
+func (s *BatchWithdrawSuite) TestEtherPayoutV1() {
+	opts := NewTesterOpts()
+	opts.PortalLayout = PortalLayoutV1
+	opts.AppAddress = s.appAddress
+	s.tester = NewTesterWithOpts(s.app, opts)
+	s.Require().Nil(s.tester.DepositEther(s.alice, big.NewInt(100), nil).Err)
+	s.withdrawals = []Withdrawal{
+		{Asset: common.Address{}, Account: s.alice, Recipient: s.bob, Value: big.NewInt(30)},
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(s.appAddress, result.Vouchers[0].Destination)
+	s.Zero(result.Vouchers[0].Value.Sign())
+	s.Equal(encodeEtherWithdraw(s.bob, big.NewInt(30)), result.Vouchers[0].Payload)
+}
+
+func (s *BatchWithdrawSuite) TestNativeToken() {
+	points, err := s.tester.env.NativeCreate(NativeToken{Name: "Points", Symbol: "PTS", Minter: s.minter})
+	s.Require().Nil(err)
+	s.Require().Nil(s.tester.env.NativeMint(points, s.alice, big.NewInt(10)))
+	s.withdrawals = []Withdrawal{
+		{Asset: points, Account: s.alice, Recipient: s.bob, Value: big.NewInt(4)},
+		{Asset: points, Account: s.alice, Recipient: s.bob, Value: big.NewInt(6)},
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(s.minter, result.Vouchers[0].Destination)
+	s.Equal(encodeNativeWithdraw(s.bob, big.NewInt(10)), result.Vouchers[0].Payload)
+	s.Equal(big.NewInt(0), s.tester.env.NativeTotalSupply(points))
+}
+
+func (s *BatchWithdrawSuite) TestFailingLeg() {
+	s.withdrawals = []Withdrawal{
+		{Asset: common.Address{}, Account: s.alice, Recipient: s.bob, Value: big.NewInt(30)},
+		{Asset: s.token, Account: s.alice, Recipient: s.alice, Value: big.NewInt(51)},
+	}
+	result := s.tester.Advance(s.alice, nil)
+	var batchErr *BatchTransferError
+	s.Require().ErrorAs(result.Err, &batchErr)
+	s.Equal(1, batchErr.Leg)
+	s.ErrorIs(result.Err, ErrInsufficientFunds)
+	s.Empty(result.Vouchers)
+	s.Equal(big.NewInt(100), s.tester.env.EtherBalanceOf(s.alice))
+}
+
+func (s *BatchWithdrawSuite) TestFailingVoucher() {
+	s.withdrawals = []Withdrawal{
+		{Asset: common.Address{}, Account: s.alice, Recipient: s.alice, Value: big.NewInt(30)},
+	}
+	failure := errors.New("failure")
+	s.tester.InjectFault(TestFault{Route: LogRouteVoucher, Err: failure})
+	result := s.tester.Advance(s.alice, nil)
+	s.ErrorIs(result.Err, failure)
+	s.Equal(big.NewInt(100), s.tester.env.EtherBalanceOf(s.alice))
+}
+
+func (s *BatchWithdrawSuite) TestOutputLimits() {
+	opts := NewTesterOpts()
+	opts.AppAddress = s.appAddress
+	opts.OutputLimits = OutputLimits{MaxOutputs: 1}
+	s.tester = NewTesterWithOpts(s.app, opts)
+	s.Require().Nil(s.tester.DepositEther(s.alice, big.NewInt(100), nil).Err)
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(50), nil).Err)
+	s.withdrawals = []Withdrawal{
+		{Asset: common.Address{}, Account: s.alice, Recipient: s.alice, Value: big.NewInt(30)},
+		{Asset: s.token, Account: s.alice, Recipient: s.alice, Value: big.NewInt(20)},
+	}
+	var err error
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		// the application handles the error, but no voucher was sent
+		_, err = env.BatchWithdraw(s.withdrawals)
+		return nil
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.ErrorIs(err, ErrOutputLimit)
+	s.Empty(result.Vouchers)
+	s.Equal(big.NewInt(100), s.tester.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(50), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+}
+
+func (s *BatchWithdrawSuite) TestFailingSecondVoucher() {
+	s.withdrawals = []Withdrawal{
+		{Asset: common.Address{}, Account: s.alice, Recipient: s.alice, Value: big.NewInt(30)},
+		{Asset: s.token, Account: s.alice, Recipient: s.alice, Value: big.NewInt(20)},
+	}
+	failure := errors.New("failure")
+	s.tester.InjectFault(TestFault{Route: LogRouteVoucher, Call: 2, Err: failure})
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		// the error can't be ignored because the first voucher was sent
+		_, _ = env.BatchWithdraw(s.withdrawals)
+		return nil
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.ErrorIs(result.Err, failure)
+	s.Equal(big.NewInt(100), s.tester.env.EtherBalanceOf(s.alice))
+}
+
+func (s *BatchWithdrawSuite) TestUnknownAppAddress() {
+	opts := NewTesterOpts()
+	opts.AppAddress = common.Address{}
+	opts.PortalLayout = PortalLayoutV1
+	s.tester = NewTesterWithOpts(s.app, opts)
+	s.Require().Nil(s.tester.DepositEther(s.alice, big.NewInt(100), nil).Err)
+	s.withdrawals = []Withdrawal{
+		{Asset: common.Address{}, Account: s.alice, Recipient: s.alice, Value: big.NewInt(30)},
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.ErrorIs(result.Err, ErrUnknownAppAddress)
+
+	// the v2 vouchers send the value to the recipient without the app address
+	opts.PortalLayout = PortalLayoutV2
+	s.tester = NewTesterWithOpts(s.app, opts)
+	s.Require().Nil(s.tester.DepositEther(s.alice, big.NewInt(100), nil).Err)
+	result = s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(s.alice, result.Vouchers[0].Destination)
+	s.Equal(big.NewInt(30), result.Vouchers[0].Value)
+}
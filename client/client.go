@@ -0,0 +1,222 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+// Package client builds the base-layer transactions that send inputs to a Rollmelette
+// application.
+// The transactions contain raw calldata, so any signer can submit them.
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rollmelette/rollmelette"
+)
+
+// ErrUnsupportedLayout is returned when the client doesn't know the calldata of the portals.
+var ErrUnsupportedLayout = errors.New("unsupported portal layout")
+
+// ErrUnknownTx is returned when the transaction isn't sent to the input box or a portal.
+var ErrUnknownTx = errors.New("unknown transaction")
+
+// contractsABI contains the functions of the input box and the portals.
+const contractsABI = `[{
+	"type": "function",
+	"name": "addInput",
+	"inputs": [
+		{"name": "appContract", "type": "address"},
+		{"name": "payload", "type": "bytes"}
+	]
+}, {
+	"type": "function",
+	"name": "depositEther",
+	"stateMutability": "payable",
+	"inputs": [
+		{"name": "appContract", "type": "address"},
+		{"name": "execLayerData", "type": "bytes"}
+	]
+}, {
+	"type": "function",
+	"name": "depositERC20Tokens",
+	"inputs": [
+		{"name": "token", "type": "address"},
+		{"name": "appContract", "type": "address"},
+		{"name": "value", "type": "uint256"},
+		{"name": "execLayerData", "type": "bytes"}
+	]
+}]`
+
+// Tx is a base-layer transaction.
+type Tx struct {
+	// To is the contract that receives the transaction.
+	To common.Address
+
+	// Value is the amount of Ether sent with the transaction, in Wei.
+	Value *big.Int
+
+	// Data is the calldata of the transaction.
+	Data []byte
+}
+
+// Client builds the transactions that send inputs to the application.
+type Client struct {
+	book       rollmelette.AddressBook
+	appAddress common.Address
+	abi        abi.ABI
+	commands   abi.ABI
+}
+
+// NewClient creates a client for the application with the given address book.
+func NewClient(book rollmelette.AddressBook, appAddress common.Address) *Client {
+	contracts, err := abi.JSON(strings.NewReader(contractsABI))
+	if err != nil {
+		log.Panicf("failed to decode ABI: %v", err)
+	}
+	commands, err := abi.JSON(strings.NewReader(rollmelette.WalletCommandsABI))
+	if err != nil {
+		log.Panicf("failed to decode ABI: %v", err)
+	}
+	return &Client{
+		book:       book,
+		appAddress: appAddress,
+		abi:        contracts,
+		commands:   commands,
+	}
+}
+
+// AddInput builds the transaction that adds the payload to the input box.
+func (c *Client) AddInput(payload []byte) Tx {
+	return Tx{
+		To:    c.book.InputBox,
+		Value: big.NewInt(0),
+		Data:  c.pack("addInput", c.appAddress, payload),
+	}
+}
+
+// DepositEther builds the transaction that deposits Ether in the application.
+// The application receives the data along with the deposit.
+func (c *Client) DepositEther(value *big.Int, data []byte) (Tx, error) {
+	if err := c.checkDeposit(value); err != nil {
+		return Tx{}, err
+	}
+	return Tx{
+		To:    c.book.EtherPortal,
+		Value: new(big.Int).Set(value),
+		Data:  c.pack("depositEther", c.appAddress, data),
+	}, nil
+}
+
+// DepositERC20 builds the transaction that deposits ERC20 tokens in the application.
+// The application receives the data along with the deposit.
+// The sender must approve the ERC20 portal to transfer the tokens before sending the transaction.
+func (c *Client) DepositERC20(token common.Address, value *big.Int, data []byte) (Tx, error) {
+	if err := c.checkDeposit(value); err != nil {
+		return Tx{}, err
+	}
+	return Tx{
+		To:    c.book.ERC20Portal,
+		Value: big.NewInt(0),
+		Data:  c.pack("depositERC20Tokens", token, c.appAddress, value, data),
+	}, nil
+}
+
+// EtherTransfer builds the transaction with the wallet command that transfers Ether from the
+// sender to the destination. The application runs it with rollmelette.HandleWalletCommand.
+func (c *Client) EtherTransfer(dst common.Address, value *big.Int) (Tx, error) {
+	return c.walletCommand("etherTransfer", value, dst, value)
+}
+
+// EtherWithdraw builds the transaction with the wallet command that withdraws Ether from the
+// sender account.
+func (c *Client) EtherWithdraw(value *big.Int) (Tx, error) {
+	return c.walletCommand("etherWithdraw", value, value)
+}
+
+// ERC20Transfer builds the transaction with the wallet command that transfers tokens from the
+// sender to the destination.
+func (c *Client) ERC20Transfer(token common.Address, dst common.Address, value *big.Int) (Tx, error) {
+	return c.walletCommand("erc20Transfer", value, token, dst, value)
+}
+
+// ERC20Withdraw builds the transaction with the wallet command that withdraws tokens from the
+// sender account.
+func (c *Client) ERC20Withdraw(token common.Address, value *big.Int) (Tx, error) {
+	return c.walletCommand("erc20Withdraw", value, token, value)
+}
+
+// Input returns the input the application receives when the sender sends the transaction.
+// It returns the msg sender of the input and its payload.
+func (c *Client) Input(sender common.Address, tx Tx) (common.Address, []byte, error) {
+	if len(tx.Data) < 4 {
+		return common.Address{}, nil, fmt.Errorf("%w: missing selector", ErrUnknownTx)
+	}
+	method, err := c.abi.MethodById(tx.Data[:4])
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("%w: %v", ErrUnknownTx, err)
+	}
+	args, err := method.Inputs.Unpack(tx.Data[4:])
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("failed to unpack %v: %w", method.Name, err)
+	}
+	switch {
+	case method.Name == "addInput" && tx.To == c.book.InputBox:
+		if args[0].(common.Address) != c.appAddress {
+			return common.Address{}, nil, fmt.Errorf("%w: input to other application", ErrUnknownTx)
+		}
+		return sender, args[1].([]byte), nil
+	case method.Name == "depositEther" && tx.To == c.book.EtherPortal:
+		if args[0].(common.Address) != c.appAddress {
+			return common.Address{}, nil, fmt.Errorf("%w: deposit to other application", ErrUnknownTx)
+		}
+		value := tx.Value
+		if value == nil {
+			value = big.NewInt(0)
+		}
+		payload := c.book.PortalLayout.EncodeEtherDeposit(sender, value, args[1].([]byte))
+		return c.book.EtherPortal, payload, nil
+	case method.Name == "depositERC20Tokens" && tx.To == c.book.ERC20Portal:
+		if args[1].(common.Address) != c.appAddress {
+			return common.Address{}, nil, fmt.Errorf("%w: deposit to other application", ErrUnknownTx)
+		}
+		token := args[0].(common.Address)
+		value := args[2].(*big.Int)
+		payload := c.book.PortalLayout.EncodeERC20Deposit(token, sender, value, args[3].([]byte))
+		return c.book.ERC20Portal, payload, nil
+	default:
+		return common.Address{}, nil, fmt.Errorf("%w: %v to %v", ErrUnknownTx, method.Name, tx.To)
+	}
+}
+
+// walletCommand builds the transaction that adds the wallet command to the input box.
+func (c *Client) walletCommand(name string, value *big.Int, args ...any) (Tx, error) {
+	if err := rollmelette.CheckValue(value); err != nil {
+		return Tx{}, err
+	}
+	data, err := c.commands.Pack(name, args...)
+	if err != nil {
+		log.Panicf("failed to pack: %v", err)
+	}
+	return c.AddInput(data), nil
+}
+
+// checkDeposit checks the layout of the portals and the deposit value.
+func (c *Client) checkDeposit(value *big.Int) error {
+	if c.book.PortalLayout != rollmelette.PortalLayoutV1 && c.book.PortalLayout != rollmelette.PortalLayoutV2 {
+		return fmt.Errorf("%w: %v", ErrUnsupportedLayout, c.book.PortalLayout)
+	}
+	return rollmelette.CheckValue(value)
+}
+
+// pack packs the arguments of the method.
+func (c *Client) pack(name string, args ...any) []byte {
+	data, err := c.abi.Pack(name, args...)
+	if err != nil {
+		log.Panicf("failed to pack: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,219 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package client
+
+import (
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/rollmelette/rollmelette"
+	"github.com/stretchr/testify/suite"
+)
+
+var sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+var token = common.HexToAddress("0xfbdb734ef6a23ad76863cba6f10d0c5cbbd8342c")
+var dst = common.HexToAddress("0xfefefefefefefefefefefefefefefefefefefefe")
+
+func TestClientSuite(t *testing.T) {
+	suite.Run(t, new(ClientSuite))
+}
+
+type ClientSuite struct {
+	suite.Suite
+	app    *recordApplication
+	tester *rollmelette.Tester
+	client *Client
+}
+
+func (s *ClientSuite) setup(layout rollmelette.PortalLayout) {
+	opts := rollmelette.NewTesterOpts()
+	opts.PortalLayout = layout
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s.app = new(recordApplication)
+	s.tester = rollmelette.NewTesterWithOpts(s.app, opts)
+	s.client = NewClient(opts.AddressBook, opts.AppAddress)
+}
+
+func (s *ClientSuite) SetupTest() {
+	s.setup(rollmelette.PortalLayoutV2)
+}
+
+func (s *ClientSuite) TestAddInput() {
+	tx := s.client.AddInput([]byte("hello"))
+	s.Equal(s.tester.Book().InputBox, tx.To)
+	s.Zero(tx.Value.Sign())
+	expected := "0x1789cd63" +
+		"000000000000000000000000ab7528bb862fb57e8a2bcd567a2e929a0be56a5e" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000005" +
+		"68656c6c6f000000000000000000000000000000000000000000000000000000"
+	s.Equal(expected, hexutil.Encode(tx.Data))
+
+	s.send(tx)
+	s.Equal(sender, s.app.metadata.MsgSender)
+	s.Nil(s.app.deposit)
+	s.Equal([]byte("hello"), s.app.payload)
+}
+
+func (s *ClientSuite) TestDepositEther() {
+	for _, layout := range []rollmelette.PortalLayout{rollmelette.PortalLayoutV1, rollmelette.PortalLayoutV2} {
+		s.setup(layout)
+		tx, err := s.client.DepositEther(big.NewInt(100), []byte("hello"))
+		s.Require().Nil(err)
+		s.Equal(s.tester.Book().EtherPortal, tx.To)
+		s.Equal(big.NewInt(100), tx.Value)
+
+		s.send(tx)
+		clientDeposit, clientPayload := s.app.deposit, s.app.payload
+		s.tester.DepositEther(sender, big.NewInt(100), []byte("hello"))
+		s.Equal(s.app.deposit, clientDeposit, layout)
+		s.Equal(s.app.payload, clientPayload, layout)
+		s.Equal([]byte("hello"), clientPayload)
+	}
+}
+
+func (s *ClientSuite) TestDepositERC20() {
+	for _, layout := range []rollmelette.PortalLayout{rollmelette.PortalLayoutV1, rollmelette.PortalLayoutV2} {
+		s.setup(layout)
+		tx, err := s.client.DepositERC20(token, big.NewInt(100), []byte("hello"))
+		s.Require().Nil(err)
+		s.Equal(s.tester.Book().ERC20Portal, tx.To)
+		s.Zero(tx.Value.Sign())
+
+		s.send(tx)
+		clientDeposit, clientPayload := s.app.deposit, s.app.payload
+		s.tester.DepositERC20(token, sender, big.NewInt(100), []byte("hello"))
+		s.Equal(s.app.deposit, clientDeposit, layout)
+		s.Equal(s.app.payload, clientPayload, layout)
+		s.Equal([]byte("hello"), clientPayload)
+	}
+}
+
+func (s *ClientSuite) TestInvalidDeposits() {
+	_, err := s.client.DepositEther(nil, nil)
+	s.ErrorIs(err, rollmelette.ErrInvalidValue)
+	_, err = s.client.DepositERC20(token, big.NewInt(-1), nil)
+	s.ErrorIs(err, rollmelette.ErrInvalidValue)
+
+	s.setup(rollmelette.PortalLayoutLayerData)
+	_, err = s.client.DepositEther(big.NewInt(1), nil)
+	s.ErrorIs(err, ErrUnsupportedLayout)
+}
+
+func (s *ClientSuite) TestWalletCommands() {
+	s.tester.DepositEther(sender, big.NewInt(100), nil)
+	s.tester.DepositERC20(token, sender, big.NewInt(100), nil)
+	s.app.commands = true
+
+	tx, err := s.client.EtherTransfer(dst, big.NewInt(30))
+	s.Require().Nil(err)
+	s.Equal(s.tester.Book().InputBox, tx.To)
+	s.send(tx)
+	s.Equal(big.NewInt(70), s.app.env.EtherBalanceOf(sender))
+	s.Equal(big.NewInt(30), s.app.env.EtherBalanceOf(dst))
+
+	tx, err = s.client.EtherWithdraw(big.NewInt(20))
+	s.Require().Nil(err)
+	result := s.send(tx)
+	s.Len(result.Vouchers, 1)
+	s.Equal(big.NewInt(50), s.app.env.EtherBalanceOf(sender))
+
+	tx, err = s.client.ERC20Transfer(token, dst, big.NewInt(40))
+	s.Require().Nil(err)
+	s.send(tx)
+	s.Equal(big.NewInt(60), s.app.env.ERC20BalanceOf(token, sender))
+	s.Equal(big.NewInt(40), s.app.env.ERC20BalanceOf(token, dst))
+
+	tx, err = s.client.ERC20Withdraw(token, big.NewInt(60))
+	s.Require().Nil(err)
+	result = s.send(tx)
+	s.Len(result.Vouchers, 1)
+	s.Equal(token, result.Vouchers[0].Destination)
+	s.Zero(s.app.env.ERC20BalanceOf(token, sender).Sign())
+
+	// the application rejects a command that fails
+	tx, err = s.client.EtherTransfer(dst, big.NewInt(51))
+	s.Require().Nil(err)
+	msgSender, payload, err := s.client.Input(sender, tx)
+	s.Require().Nil(err)
+	s.ErrorIs(s.tester.Advance(msgSender, payload).Err, rollmelette.ErrInsufficientFunds)
+
+	// the application handles other inputs
+	s.send(s.client.AddInput([]byte("hello")))
+	s.Equal([]byte("hello"), s.app.payload)
+}
+
+func (s *ClientSuite) TestInvalidWalletCommands() {
+	_, err := s.client.EtherTransfer(dst, nil)
+	s.ErrorIs(err, rollmelette.ErrInvalidValue)
+	_, err = s.client.ERC20Withdraw(token, big.NewInt(-1))
+	s.ErrorIs(err, rollmelette.ErrInvalidValue)
+
+	// a command with a known selector but malformed arguments is rejected
+	s.app.commands = true
+	tx, err := s.client.EtherWithdraw(big.NewInt(1))
+	s.Require().Nil(err)
+	msgSender, payload, err := s.client.Input(sender, tx)
+	s.Require().Nil(err)
+	result := s.tester.Advance(msgSender, payload[:8])
+	s.ErrorContains(result.Err, "failed to unpack etherWithdraw")
+}
+
+func (s *ClientSuite) TestUnknownTx() {
+	tx := s.client.AddInput(nil)
+	tx.To = token
+	_, _, err := s.client.Input(sender, tx)
+	s.ErrorIs(err, ErrUnknownTx)
+
+	_, _, err = s.client.Input(sender, Tx{To: token, Data: []byte{1, 2, 3, 4}})
+	s.ErrorIs(err, ErrUnknownTx)
+
+	other := NewClient(s.tester.Book(), token)
+	_, _, err = s.client.Input(sender, other.AddInput(nil))
+	s.ErrorIs(err, ErrUnknownTx)
+}
+
+// send sends the input of the transaction to the tester.
+func (s *ClientSuite) send(tx Tx) rollmelette.TestAdvanceResult {
+	msgSender, payload, err := s.client.Input(sender, tx)
+	s.Require().Nil(err)
+	result := s.tester.Advance(msgSender, payload)
+	s.Require().Nil(result.Err)
+	return result
+}
+
+// recordApplication records the last advance input.
+// If commands is true, it also runs the wallet commands.
+type recordApplication struct {
+	commands bool
+	env      rollmelette.Env
+	metadata rollmelette.Metadata
+	deposit  rollmelette.Deposit
+	payload  []byte
+}
+
+func (a *recordApplication) Advance(
+	env rollmelette.Env,
+	metadata rollmelette.Metadata,
+	deposit rollmelette.Deposit,
+	payload []byte,
+) error {
+	a.env = env
+	a.metadata = metadata
+	a.deposit = deposit
+	a.payload = payload
+	if a.commands {
+		_, err := rollmelette.HandleWalletCommand(env, metadata.MsgSender, payload)
+		return err
+	}
+	return nil
+}
+
+func (a *recordApplication) Inspect(env rollmelette.EnvInspector, payload []byte) error {
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WalletCommandsABI is the ABI of the standard wallet commands.
+// An advance input with the ABI-encoded call of one of these functions asks the application to
+// run the wallet operation on behalf of the input sender.
+// The client package encodes these commands, and HandleWalletCommand runs them.
+const WalletCommandsABI = `[{
+	"type": "function",
+	"name": "etherTransfer",
+	"inputs": [
+		{"name": "dst", "type": "address"},
+		{"name": "value", "type": "uint256"}
+	]
+}, {
+	"type": "function",
+	"name": "etherWithdraw",
+	"inputs": [
+		{"name": "value", "type": "uint256"}
+	]
+}, {
+	"type": "function",
+	"name": "erc20Transfer",
+	"inputs": [
+		{"name": "token", "type": "address"},
+		{"name": "dst", "type": "address"},
+		{"name": "value", "type": "uint256"}
+	]
+}, {
+	"type": "function",
+	"name": "erc20Withdraw",
+	"inputs": [
+		{"name": "token", "type": "address"},
+		{"name": "value", "type": "uint256"}
+	]
+}]`
+
+var walletCommands = newWalletCommandsABI()
+
+func newWalletCommandsABI() abi.ABI {
+	commands, err := abi.JSON(strings.NewReader(WalletCommandsABI))
+	if err != nil {
+		log.Panicf("failed to decode ABI: %v", err)
+	}
+	return commands
+}
+
+// HandleWalletCommand runs the standard wallet command in the payload on behalf of the sender.
+// It returns false if the payload isn't a wallet command, so the application may handle it.
+// It returns true and an error if the command is malformed or the wallet operation fails.
+func HandleWalletCommand(env Env, sender common.Address, payload []byte) (bool, error) {
+	if len(payload) < 4 {
+		return false, nil
+	}
+	method, err := walletCommands.MethodById(payload[:4])
+	if err != nil {
+		return false, nil
+	}
+	args, err := method.Inputs.Unpack(payload[4:])
+	if err != nil {
+		return true, fmt.Errorf("failed to unpack %v: %w", method.Name, err)
+	}
+	switch method.Name {
+	case "etherTransfer":
+		err = env.EtherTransfer(sender, args[0].(common.Address), args[1].(*big.Int))
+	case "etherWithdraw":
+		_, err = env.EtherWithdraw(sender, args[0].(*big.Int))
+	case "erc20Transfer":
+		err = env.ERC20Transfer(args[0].(common.Address), sender, args[1].(common.Address),
+			args[2].(*big.Int))
+	case "erc20Withdraw":
+		_, err = env.ERC20Withdraw(args[0].(common.Address), sender, args[1].(*big.Int))
+	}
+	return true, err
+}
@@ -0,0 +1,171 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// runConfig contains the raw configuration values read from the environment and the flags.
+type runConfig struct {
+	rollupURL       string
+	addressBook     string
+	addressBookFile string
+	appAddress      string
+	portalLayout    string
+	logLevel        string
+	logFormat       string
+	logMaxPayload   string
+	metricsAddr     string
+	maxOutputs      string
+	maxOutputBytes  string
+}
+
+// LoadRunOpts creates a RunOpts struct from the environment variables and the command-line flags.
+//
+// The function reads the following environment variables:
+//   - ROLLUP_HTTP_SERVER_URL: the URL of the Rollup API.
+//   - ROLLMELETTE_ADDRESS_BOOK: the name of the address book preset.
+//   - ROLLMELETTE_ADDRESS_BOOK_FILE: the path of the JSON or TOML deployment file with the
+//     addresses; they override the addresses of the preset.
+//   - ROLLMELETTE_APP_ADDRESS: the address of the application contract.
+//   - ROLLMELETTE_PORTAL_LAYOUT: the layout of the portal payloads.
+//   - ROLLMELETTE_LOG_LEVEL: the log level, as a number or a name.
+//   - ROLLMELETTE_LOG_FORMAT: the log format.
+//   - ROLLMELETTE_LOG_MAX_PAYLOAD: the max number of payload bytes in a log message.
+//   - ROLLMELETTE_METRICS_ADDR: the address where Run serves the metrics, such as ":9100".
+//   - ROLLMELETTE_MAX_OUTPUTS: the max number of vouchers and notices of each input.
+//   - ROLLMELETTE_MAX_OUTPUT_BYTES: the max payload size of each output.
+//
+// It also reads the address overrides described in LoadAddressBookEnv.
+// If flags is not nil, the function registers the equivalent flags in the set and parses args.
+// The flags take precedence over the environment variables.
+func LoadRunOpts(flags *flag.FlagSet, args []string) (*RunOpts, error) {
+	defaults := NewRunOpts()
+	config := runConfig{
+		rollupURL: defaults.RollupURL,
+		logLevel:  defaults.LogLevel.String(),
+		logFormat: string(LogFormatTint),
+	}
+	envs := []struct {
+		name  string
+		value *string
+	}{
+		{"ROLLUP_HTTP_SERVER_URL", &config.rollupURL},
+		{"ROLLMELETTE_ADDRESS_BOOK", &config.addressBook},
+		{"ROLLMELETTE_ADDRESS_BOOK_FILE", &config.addressBookFile},
+		{"ROLLMELETTE_APP_ADDRESS", &config.appAddress},
+		{"ROLLMELETTE_PORTAL_LAYOUT", &config.portalLayout},
+		{"ROLLMELETTE_LOG_LEVEL", &config.logLevel},
+		{"ROLLMELETTE_LOG_FORMAT", &config.logFormat},
+		{"ROLLMELETTE_LOG_MAX_PAYLOAD", &config.logMaxPayload},
+		{"ROLLMELETTE_METRICS_ADDR", &config.metricsAddr},
+		{"ROLLMELETTE_MAX_OUTPUTS", &config.maxOutputs},
+		{"ROLLMELETTE_MAX_OUTPUT_BYTES", &config.maxOutputBytes},
+	}
+	for _, env := range envs {
+		if value, ok := os.LookupEnv(env.name); ok {
+			*env.value = value
+		}
+	}
+
+	if flags != nil {
+		flags.StringVar(&config.rollupURL, "rollup-url", config.rollupURL,
+			"URL of the Rollup API")
+		flags.StringVar(&config.addressBook, "address-book", config.addressBook,
+			"name of the address book preset")
+		flags.StringVar(&config.addressBookFile, "address-book-file", config.addressBookFile,
+			"path of the JSON or TOML deployment file with the contract addresses")
+		flags.StringVar(&config.appAddress, "app-address", config.appAddress,
+			"address of the application contract")
+		flags.StringVar(&config.portalLayout, "portal-layout", config.portalLayout,
+			"layout of the portal payloads; defaults to the layout of the address book")
+		flags.StringVar(&config.logLevel, "log-level", config.logLevel,
+			"log level")
+		flags.StringVar(&config.logFormat, "log-format", config.logFormat,
+			"log format")
+		flags.StringVar(&config.logMaxPayload, "log-max-payload", config.logMaxPayload,
+			"max number of payload bytes in a log message")
+		flags.StringVar(&config.metricsAddr, "metrics-addr", config.metricsAddr,
+			"address where the metrics are served in the Prometheus text format")
+		flags.StringVar(&config.maxOutputs, "max-outputs", config.maxOutputs,
+			"max number of vouchers and notices of each input")
+		flags.StringVar(&config.maxOutputBytes, "max-output-bytes", config.maxOutputBytes,
+			"max payload size of each output")
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	return config.runOpts()
+}
+
+// runOpts parses the configuration values and creates the RunOpts struct.
+func (c *runConfig) runOpts() (*RunOpts, error) {
+	var err error
+	opts := NewRunOpts()
+	opts.RollupURL = c.rollupURL
+	if c.addressBook != "" {
+		if opts.AddressBook, err = NewAddressBookPreset(c.addressBook); err != nil {
+			return nil, err
+		}
+	}
+	if c.addressBookFile != "" {
+		if opts.AddressBook, err = loadAddressBookFile(opts.AddressBook, c.addressBookFile); err != nil {
+			return nil, err
+		}
+	}
+	if opts.AddressBook, err = LoadAddressBookEnv(opts.AddressBook); err != nil {
+		return nil, err
+	}
+	if c.portalLayout != "" {
+		if opts.PortalLayout, err = ParsePortalLayout(c.portalLayout); err != nil {
+			return nil, err
+		}
+	}
+	if c.appAddress != "" {
+		if !common.IsHexAddress(c.appAddress) {
+			return nil, fmt.Errorf("invalid app address: %v", c.appAddress)
+		}
+		opts.AppAddress = common.HexToAddress(c.appAddress)
+	}
+	if opts.LogLevel, err = ParseLogLevel(c.logLevel); err != nil {
+		return nil, err
+	}
+	if opts.LogFormat, err = ParseLogFormat(c.logFormat); err != nil {
+		return nil, err
+	}
+	if c.logMaxPayload != "" {
+		maxPayload, err := strconv.Atoi(c.logMaxPayload)
+		if err != nil || maxPayload < 0 {
+			return nil, fmt.Errorf("invalid log max payload: %v", c.logMaxPayload)
+		}
+		opts.LogPolicy.MaxPayloadBytes = maxPayload
+	}
+	opts.MetricsAddr = c.metricsAddr
+	if opts.OutputLimits.MaxOutputs, err = parseLimit("max outputs", c.maxOutputs); err != nil {
+		return nil, err
+	}
+	if opts.OutputLimits.MaxPayloadBytes, err = parseLimit("max output bytes", c.maxOutputBytes); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// parseLimit parses a non-negative limit; the empty string means no limit.
+func parseLimit(name string, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid %v: %v", name, value)
+	}
+	return limit, nil
+}
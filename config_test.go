@@ -0,0 +1,137 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestConfigSuite(t *testing.T) {
+	suite.Run(t, new(ConfigSuite))
+}
+
+type ConfigSuite struct {
+	suite.Suite
+	flags *flag.FlagSet
+}
+
+func (s *ConfigSuite) SetupTest() {
+	s.flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	s.flags.SetOutput(io.Discard)
+}
+
+func (s *ConfigSuite) TestDefaults() {
+	opts, err := LoadRunOpts(nil, nil)
+	s.Require().Nil(err)
+	s.Equal(NewRunOpts(), opts)
+}
+
+func (s *ConfigSuite) TestEnv() {
+	appAddress := common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.T().Setenv("ROLLUP_HTTP_SERVER_URL", "http://127.0.0.1:5005")
+	s.T().Setenv("ROLLMELETTE_ADDRESS_BOOK", "v1/mainnet")
+	s.T().Setenv("ROLLMELETTE_APP_ADDRESS", appAddress.String())
+	s.T().Setenv("ROLLMELETTE_ETHER_PORTAL", appAddress.String())
+	s.T().Setenv("ROLLMELETTE_LOG_LEVEL", "warn")
+	s.T().Setenv("ROLLMELETTE_LOG_FORMAT", "text")
+	s.T().Setenv("ROLLMELETTE_LOG_MAX_PAYLOAD", "64")
+	opts, err := LoadRunOpts(nil, nil)
+	s.Require().Nil(err)
+	s.Equal("http://127.0.0.1:5005", opts.RollupURL)
+	s.Equal(newAddressBookV1().ERC20Portal, opts.ERC20Portal)
+	s.Equal(appAddress, opts.EtherPortal)
+	s.Equal(PortalLayoutV1, opts.PortalLayout)
+	s.Equal(appAddress, opts.AppAddress)
+	s.Equal(slog.LevelWarn, opts.LogLevel)
+	s.Equal(LogFormatText, opts.LogFormat)
+	s.Equal(64, opts.LogPolicy.MaxPayloadBytes)
+}
+
+func (s *ConfigSuite) TestFlagsOverrideEnv() {
+	s.T().Setenv("ROLLUP_HTTP_SERVER_URL", "http://127.0.0.1:5005")
+	s.T().Setenv("ROLLMELETTE_LOG_LEVEL", "4")
+	args := []string{
+		"-rollup-url", "http://127.0.0.1:5006",
+		"-portal-layout", "layer-data",
+		"-log-level", "-4",
+		"echo",
+	}
+	opts, err := LoadRunOpts(s.flags, args)
+	s.Require().Nil(err)
+	s.Equal("http://127.0.0.1:5006", opts.RollupURL)
+	s.Equal(PortalLayoutLayerData, opts.PortalLayout)
+	s.Equal(slog.LevelDebug, opts.LogLevel)
+	s.Equal([]string{"echo"}, s.flags.Args())
+}
+
+func (s *ConfigSuite) TestAddressBookFileOverridesDefaults() {
+	address := common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	path := filepath.Join(s.T().TempDir(), "deployment.json")
+	err := os.WriteFile(path, []byte(`{"EtherPortal": "`+address.String()+`"}`), 0600)
+	s.Require().Nil(err)
+	opts, err := LoadRunOpts(s.flags, []string{"-address-book-file", path})
+	s.Require().Nil(err)
+	s.Equal(address, opts.EtherPortal)
+	s.Equal(NewAddressBook().ERC20Portal, opts.ERC20Portal)
+	s.Equal(NewAddressBook().PortalLayout, opts.PortalLayout)
+
+	s.SetupTest()
+	opts, err = LoadRunOpts(s.flags, []string{"-address-book", "v1/mainnet", "-address-book-file", path})
+	s.Require().Nil(err)
+	s.Equal(address, opts.EtherPortal)
+	s.Equal(newAddressBookV1().ERC20Portal, opts.ERC20Portal)
+	s.Equal(PortalLayoutV1, opts.PortalLayout)
+}
+
+func (s *ConfigSuite) TestFeatureToggles() {
+	s.T().Setenv("ROLLMELETTE_MAX_OUTPUTS", "8")
+	opts, err := LoadRunOpts(s.flags, []string{"-metrics-addr", ":9100", "-max-output-bytes", "1024"})
+	s.Require().Nil(err)
+	s.Equal(":9100", opts.MetricsAddr)
+	s.Nil(opts.Metrics)
+	s.Equal(OutputLimits{MaxOutputs: 8, MaxPayloadBytes: 1024}, opts.OutputLimits)
+
+	s.SetupTest()
+	s.T().Setenv("ROLLMELETTE_METRICS_ADDR", ":9100")
+	opts, err = LoadRunOpts(s.flags, []string{"-metrics-addr", "127.0.0.1:9200"})
+	s.Require().Nil(err)
+	s.Equal("127.0.0.1:9200", opts.MetricsAddr)
+}
+
+func (s *ConfigSuite) TestInvalidValues() {
+	_, err := LoadRunOpts(s.flags, []string{"-app-address", "0xfafa"})
+	s.ErrorContains(err, "invalid app address: 0xfafa")
+
+	s.SetupTest()
+	_, err = LoadRunOpts(s.flags, []string{"-log-format", "xml"})
+	s.ErrorContains(err, "invalid log format: xml")
+
+	s.SetupTest()
+	_, err = LoadRunOpts(s.flags, []string{"-log-level", "loud"})
+	s.ErrorContains(err, "invalid log level: loud")
+
+	s.SetupTest()
+	_, err = LoadRunOpts(s.flags, []string{"-log-max-payload", "-1"})
+	s.ErrorContains(err, "invalid log max payload: -1")
+
+	s.SetupTest()
+	_, err = LoadRunOpts(s.flags, []string{"-address-book", "v3/mainnet"})
+	s.ErrorContains(err, "preset not found: v3/mainnet")
+
+	s.SetupTest()
+	_, err = LoadRunOpts(s.flags, []string{"-max-outputs", "many"})
+	s.ErrorContains(err, "invalid max outputs: many")
+
+	s.SetupTest()
+	_, err = LoadRunOpts(s.flags, []string{"-max-output-bytes", "-1"})
+	s.ErrorContains(err, "invalid max output bytes: -1")
+}
@@ -10,7 +10,6 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 // env is the implementation of the Env interface.
@@ -22,24 +21,94 @@ type env struct {
 	rollup      rollupEnv
 	app         Application
 	appAddress  common.Address
+	logger      *payloadLogger
+	metrics     MetricsSink
+	memory      bool
+	meter       *inputMeter
+	inspects    int
+	tracer      Tracer
+	limits      OutputLimits
+	outputs     int
+	fees        FeePolicy
+	collected   []Fee
+	tokens      TokenRegistry
+	rollback    bool
+	snapshot    *envSnapshot
+	scheduler   scheduler
 	etherWallet *etherWallet
 	erc20Wallet *erc20Wallet
+	native      *nativeWallet
 }
 
-func newEnv(ctx context.Context, addressBook AddressBook, rollup rollupEnv, app Application) *env {
-	return &env{
+// envSnapshot contains the state restored when the env rejects an advance input.
+// The Cartesi Machine reverts the application state in this case, so only the Tester, which
+// emulates the machine, takes snapshots.
+type envSnapshot struct {
+	appAddress   common.Address
+	etherBalance map[common.Address]big.Int
+	erc20Balance map[common.Address]map[common.Address]big.Int
+	etherLocks   map[lockKey]map[string]big.Int
+	erc20Locks   map[lockKey]map[string]big.Int
+	native       nativeSnapshot
+	scheduler    schedulerSnapshot
+}
+
+// envOpts contains the options shared by the running and testing functions to create the env.
+type envOpts struct {
+	book       AddressBook
+	appAddress common.Address
+	logger     *payloadLogger
+	metrics    MetricsSink
+	memory     bool
+	tracer     Tracer
+	limits     OutputLimits
+	fees       FeePolicy
+	tokens     TokenRegistry
+	rollback   bool
+}
+
+// The env logs with the given context until it handles the first input.
+func newEnv(ctx context.Context, rollup rollupEnv, app Application, opts envOpts) *env {
+	e := &env{
 		ctx:         ctx,
-		AddressBook: addressBook,
+		AddressBook: opts.book,
 		rollup:      rollup,
 		app:         app,
+		appAddress:  opts.appAddress,
+		logger:      opts.logger,
+		metrics:     opts.metrics,
+		memory:      opts.memory,
+		tracer:      opts.tracer,
+		limits:      opts.limits,
+		fees:        opts.fees,
+		rollback:    opts.rollback,
 		etherWallet: newEtherWallet(),
 		erc20Wallet: newErc20Wallet(),
+		native:      newNativeWallet(),
+	}
+	e.etherWallet.layout = opts.book.PortalLayout
+	e.etherWallet.logger = opts.logger
+	e.erc20Wallet.layout = opts.book.PortalLayout
+	e.erc20Wallet.logger = opts.logger
+	e.tokens = opts.tokens
+	if e.tokens == nil {
+		e.tokens = NewTokenRegistry(opts.book)
+	}
+	if e.tracer == nil {
+		e.tracer = noopTracer{}
 	}
+	return e
 }
 
 // handlers ////////////////////////////////////////////////////////////////////////////////////////
 
-func (e *env) handle(input any) (err error) {
+// handle handles the input and returns an error if the input should be rejected.
+// The env uses the given context to send the outputs of the input.
+// After handling the input, the env context carries the input span.
+func (e *env) handle(ctx context.Context, input any) (err error) {
+	ctx, span := e.tracer.Start(ctx, SpanInput, inputSpanAttrs(input)...)
+	e.outputs = 0
+	e.collected = nil
 	defer func() {
 		// Recover from panic so we can safely reject the input and print an error message.
 		panicObj := recover()
@@ -52,13 +121,27 @@ func (e *env) handle(input any) (err error) {
 			}
 		}
 		if err != nil {
-			slog.Error("input rejected", "error", err)
+			e.logger.Error("input rejected", "error", err)
+			e.restoreSnapshot()
+			e.collected = nil
 		}
+		e.snapshot = nil
+		if e.meter != nil {
+			e.metrics.RecordInput(e.meter.finish(err == nil, panicObj != nil))
+			e.meter = nil
+		}
+		endSpan(span, err)
 	}()
 	switch input := input.(type) {
 	case *advanceInput:
+		e.ctx = e.logger.withInput(ctx, LogRouteAdvance, input.Metadata.MsgSender)
+		e.startMeter(LogRouteAdvance, input.Metadata.Index)
+		e.takeSnapshot()
 		return e.handleAdvance(input)
 	case *inspectInput:
+		e.ctx = e.logger.withInput(ctx, LogRouteInspect, common.Address{})
+		e.startMeter(LogRouteInspect, e.inspects)
+		e.inspects++
 		return e.handleInspect(input.Payload)
 	default:
 		// impossible
@@ -66,8 +149,52 @@ func (e *env) handle(input any) (err error) {
 	}
 }
 
+// takeSnapshot saves the state before the advance input, if the env rolls back rejected inputs.
+func (e *env) takeSnapshot() {
+	if !e.rollback {
+		return
+	}
+	e.snapshot = &envSnapshot{
+		appAddress:   e.appAddress,
+		etherBalance: e.etherWallet.snapshot(),
+		erc20Balance: e.erc20Wallet.snapshot(),
+		etherLocks:   e.etherWallet.locks.snapshot(),
+		erc20Locks:   e.erc20Wallet.locks.snapshot(),
+		native:       e.native.snapshot(),
+		scheduler:    e.scheduler.snapshot(),
+	}
+}
+
+// restoreSnapshot restores the state before the advance input, if there is a snapshot.
+func (e *env) restoreSnapshot() {
+	if e.snapshot == nil {
+		return
+	}
+	e.appAddress = e.snapshot.appAddress
+	e.etherWallet.restore(e.snapshot.etherBalance)
+	e.erc20Wallet.restore(e.snapshot.erc20Balance)
+	e.etherWallet.locks.restore(e.snapshot.etherLocks)
+	e.erc20Wallet.locks.restore(e.snapshot.erc20Locks)
+	e.native.restore(e.snapshot.native)
+	e.scheduler.restore(e.snapshot.scheduler)
+}
+
+// startMeter starts measuring the input if there is a metrics sink.
+func (e *env) startMeter(route string, index int) {
+	if e.metrics != nil {
+		e.meter = newInputMeter(route, index, e.memory)
+	}
+}
+
+// recordOutput records the output in the metrics of the current input.
+func (e *env) recordOutput(route string, payload []byte) {
+	if e.meter != nil {
+		e.meter.output(route, payload)
+	}
+}
+
 func (e *env) handleAdvance(input *advanceInput) error {
-	slog.Debug("received advance",
+	e.logger.debug(e.ctx, "received advance", LogRouteAdvance, input.Payload,
 		"chainId", input.Metadata.ChainId,
 		"appContract", input.Metadata.AppContract,
 		"msgSender", input.Metadata.MsgSender,
@@ -75,14 +202,21 @@ func (e *env) handleAdvance(input *advanceInput) error {
 		"blockTimestamp", input.Metadata.BlockTimestamp,
 		"prevRandao", input.Metadata.PrevRandao,
 		"index", input.Metadata.Index,
-		"payload", hexutil.Encode(input.Payload),
 	)
 	var (
 		err     error
 		deposit Deposit
 		payload = input.Payload
 	)
-	e.appAddress = (common.Address)(input.Metadata.AppContract)
+	if input.Metadata.AppContract != (common.Address{}) {
+		e.appAddress = input.Metadata.AppContract
+	}
+	if err := e.runScheduled(&input.Metadata); err != nil {
+		return err
+	}
+	if e.AppAddressRelay != (common.Address{}) && input.Metadata.MsgSender == e.AppAddressRelay {
+		return e.handleAppAddressRelay(payload)
+	}
 	switch input.Metadata.MsgSender {
 	case e.EtherPortal:
 		deposit, payload, err = e.etherWallet.deposit(payload)
@@ -93,28 +227,113 @@ func (e *env) handleAdvance(input *advanceInput) error {
 		return err
 	}
 	if deposit != nil {
-		slog.Debug("received deposit", "deposit", deposit)
+		e.logger.Debug("received deposit", "deposit", e.formatDeposit(deposit))
+		if err := e.chargeDeposit(deposit); err != nil {
+			return err
+		}
+	}
+	return e.traceApp(func() error {
+		return e.app.Advance(e, input.Metadata, deposit, payload)
+	})
+}
+
+// formatDeposit formats the deposit for the logs, with the ERC20 amount in the token units.
+func (e *env) formatDeposit(deposit Deposit) string {
+	if d, ok := deposit.(*ERC20Deposit); ok {
+		return fmt.Sprintf("%v deposited %v", d.Sender, e.tokens.Format(d.Token, d.Value))
+	}
+	return fmt.Sprint(deposit)
+}
+
+// runScheduled runs the due actions before the application handles the input.
+func (e *env) runScheduled(metadata *Metadata) error {
+	due := e.scheduler.popDue(metadata)
+	if len(due) == 0 {
+		return nil
+	}
+	return e.traceApp(func() error {
+		for _, action := range due {
+			e.logger.Debug("running scheduled action", "id", action.id)
+			if err := action.action(e, *metadata); err != nil {
+				return fmt.Errorf("scheduled action %v: %w", action.id, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (e *env) handleAppAddressRelay(payload []byte) error {
+	if len(payload) != common.AddressLength {
+		return fmt.Errorf("invalid app address relay size; got %v", len(payload))
 	}
-	return e.app.Advance(e, input.Metadata, deposit, payload)
+	e.appAddress = common.BytesToAddress(payload)
+	e.logger.Debug("received app address", "appAddress", e.appAddress)
+	return nil
 }
 
 func (e *env) handleInspect(payload []byte) error {
-	slog.Debug("received inspect", "payload", hexutil.Encode(payload))
-	return e.app.Inspect(e, payload)
+	e.logger.debug(e.ctx, "received inspect", LogRouteInspect, payload)
+	return e.traceApp(func() error {
+		return e.app.Inspect(e, payload)
+	})
+}
+
+// traceApp calls the application inside the application span.
+func (e *env) traceApp(call func() error) (err error) {
+	ctx := e.ctx
+	var span Span
+	e.ctx, span = e.tracer.Start(ctx, SpanApplication)
+	defer func() {
+		e.ctx = ctx
+		endSpan(span, err)
+	}()
+	return call()
+}
+
+// inputSpanAttrs returns the attributes of the input span.
+func inputSpanAttrs(input any) []slog.Attr {
+	switch input := input.(type) {
+	case *advanceInput:
+		return []slog.Attr{
+			slog.String("route", LogRouteAdvance),
+			slog.Int("index", input.Metadata.Index),
+			slog.String("msgSender", input.Metadata.MsgSender.String()),
+		}
+	case *inspectInput:
+		return []slog.Attr{slog.String("route", LogRouteInspect)}
+	default:
+		return nil
+	}
 }
 
 // EnvInspector interface //////////////////////////////////////////////////////////////////////////
 
 func (e *env) Report(payload []byte) {
-	slog.Debug("sending report", "payload", hexutil.Encode(payload))
-	err := e.rollup.sendReport(e.ctx, payload)
+	err := e.TryReport(payload)
 	if err != nil {
 		panic(err)
 	}
 }
 
-func (e *env) AppAddress() common.Address {
-	return e.appAddress
+func (e *env) TryReport(payload []byte) error {
+	if err := e.limits.check(LogRouteReport, e.outputs, payload); err != nil {
+		return err
+	}
+	e.logger.debug(e.ctx, "sending report", LogRouteReport, payload)
+	err := e.rollup.sendReport(e.ctx, payload)
+	if err != nil {
+		return err
+	}
+	e.recordOutput(LogRouteReport, payload)
+	return nil
+}
+
+func (e *env) AppAddress() (common.Address, bool) {
+	return e.appAddress, e.appAddress != (common.Address{})
+}
+
+func (e *env) ScheduledActions() []int {
+	return e.scheduler.pending()
 }
 
 func (e *env) EtherAddresses() []common.Address {
@@ -125,6 +344,18 @@ func (e *env) EtherBalanceOf(address common.Address) *big.Int {
 	return e.etherWallet.balanceOf(address)
 }
 
+func (e *env) EtherAvailableOf(address common.Address) *big.Int {
+	return e.etherWallet.availableOf(address)
+}
+
+func (e *env) EtherLockedOf(address common.Address) *big.Int {
+	return e.etherWallet.locks.total(common.Address{}, address)
+}
+
+func (e *env) EtherLocks(address common.Address) []Lock {
+	return e.etherWallet.locks.list(common.Address{}, address)
+}
+
 func (e *env) ERC20Tokens() []common.Address {
 	return e.erc20Wallet.tokens()
 }
@@ -137,45 +368,142 @@ func (e *env) ERC20BalanceOf(token common.Address, address common.Address) *big.
 	return e.erc20Wallet.balanceOf(token, address)
 }
 
+func (e *env) ERC20AvailableOf(token common.Address, address common.Address) *big.Int {
+	return e.erc20Wallet.availableOf(token, address)
+}
+
+func (e *env) ERC20LockedOf(token common.Address, address common.Address) *big.Int {
+	return e.erc20Wallet.locks.total(token, address)
+}
+
+func (e *env) ERC20Locks(token common.Address, address common.Address) []Lock {
+	return e.erc20Wallet.locks.list(token, address)
+}
+
+func (e *env) NativeTokens() []NativeToken {
+	return e.native.list()
+}
+
+func (e *env) NativeToken(token common.Address) (NativeToken, bool) {
+	info, err := e.native.token(token)
+	return info, err == nil
+}
+
+func (e *env) NativeAddresses(token common.Address) []common.Address {
+	return e.native.balance.addresses(token)
+}
+
+func (e *env) NativeBalanceOf(token common.Address, address common.Address) *big.Int {
+	return e.native.balance.balanceOf(token, address)
+}
+
+func (e *env) NativeTotalSupply(token common.Address) *big.Int {
+	return e.native.totalSupply(token)
+}
+
 // Env interface ///////////////////////////////////////////////////////////////////////////////////
 
 func (e *env) Voucher(destination common.Address, value *big.Int, payload []byte) int {
-	slog.Debug("sending voucher", "destination", destination, "value", value, "payload", hexutil.Encode(payload))
-	index, err := e.rollup.sendVoucher(e.ctx, destination, value, payload)
+	index, err := e.TryVoucher(destination, value, payload)
 	if err != nil {
 		panic(err)
 	}
 	return index
 }
 
+func (e *env) TryVoucher(destination common.Address, value *big.Int, payload []byte) (int, error) {
+	if err := e.limits.check(LogRouteVoucher, e.outputs, payload); err != nil {
+		return 0, err
+	}
+	e.logger.debug(e.ctx, "sending voucher", LogRouteVoucher, payload,
+		"destination", destination, "value", value)
+	index, err := e.rollup.sendVoucher(e.ctx, destination, value, payload)
+	if err != nil {
+		return 0, err
+	}
+	e.outputs++
+	e.recordOutput(LogRouteVoucher, payload)
+	return index, nil
+}
+
 func (e *env) DelegateCallVoucher(destination common.Address, payload []byte) int {
-	slog.Debug("sending delegate call voucher", "destination", destination, "payload", hexutil.Encode(payload))
-	index, err := e.rollup.sendDelegateCallVoucher(e.ctx, destination, payload)
+	index, err := e.TryDelegateCallVoucher(destination, payload)
 	if err != nil {
 		panic(err)
 	}
 	return index
 }
 
+func (e *env) TryDelegateCallVoucher(destination common.Address, payload []byte) (int, error) {
+	if err := e.limits.check(LogRouteDelegateCallVoucher, e.outputs, payload); err != nil {
+		return 0, err
+	}
+	e.logger.debug(e.ctx, "sending delegate call voucher", LogRouteDelegateCallVoucher, payload,
+		"destination", destination)
+	index, err := e.rollup.sendDelegateCallVoucher(e.ctx, destination, payload)
+	if err != nil {
+		return 0, err
+	}
+	e.outputs++
+	e.recordOutput(LogRouteDelegateCallVoucher, payload)
+	return index, nil
+}
+
 func (e *env) Notice(payload []byte) int {
-	slog.Debug("sending notice", "payload", hexutil.Encode(payload))
-	index, err := e.rollup.sendNotice(e.ctx, payload)
+	index, err := e.TryNotice(payload)
 	if err != nil {
 		panic(err)
 	}
 	return index
 }
 
+func (e *env) TryNotice(payload []byte) (int, error) {
+	if err := e.limits.check(LogRouteNotice, e.outputs, payload); err != nil {
+		return 0, err
+	}
+	e.logger.debug(e.ctx, "sending notice", LogRouteNotice, payload)
+	index, err := e.rollup.sendNotice(e.ctx, payload)
+	if err != nil {
+		return 0, err
+	}
+	e.outputs++
+	e.recordOutput(LogRouteNotice, payload)
+	return index, nil
+}
+
 func (e *env) EtherTransfer(src common.Address, dst common.Address, value *big.Int) error {
-	return e.etherWallet.transfer(src, dst, value)
+	return e.transferWithFee(Transfer{Src: src, Dst: dst, Value: value}, func() error {
+		return e.etherWallet.transfer(src, dst, value)
+	})
 }
 
 func (e *env) EtherWithdraw(address common.Address, value *big.Int) (int, error) {
+	return e.EtherWithdrawTo(address, address, value)
+}
+
+func (e *env) EtherWithdrawTo(address common.Address, recipient common.Address, value *big.Int) (int, error) {
+	if err := e.checkEtherVoucher(); err != nil {
+		return 0, err
+	}
+	balance := e.etherWallet.balanceOf(address)
 	err := e.etherWallet.withdraw(address, value)
 	if err != nil {
 		return 0, err
 	}
-	return e.Voucher(e.appAddress, value, nil), nil
+	restore := e.saveFees(common.Address{}, address, balance)
+	value, err = e.withdrawFee(common.Address{}, address, value)
+	if err != nil {
+		restore()
+		return 0, err
+	}
+	destination, voucherValue, payload := etherVoucher(e.PortalLayout, e.appAddress, recipient, value)
+	index, err := e.TryVoucher(destination, voucherValue, payload)
+	if err != nil {
+		// restore the balance because the voucher wasn't sent
+		restore()
+		return 0, err
+	}
+	return index, nil
 }
 
 func (e *env) ERC20Transfer(
@@ -184,7 +512,9 @@ func (e *env) ERC20Transfer(
 	dst common.Address,
 	value *big.Int,
 ) error {
-	return e.erc20Wallet.transfer(token, src, dst, value)
+	return e.transferWithFee(Transfer{Asset: token, Src: src, Dst: dst, Value: value}, func() error {
+		return e.erc20Wallet.transfer(token, src, dst, value)
+	})
 }
 
 func (e *env) ERC20Withdraw(
@@ -192,17 +522,151 @@ func (e *env) ERC20Withdraw(
 	address common.Address,
 	value *big.Int,
 ) (int, error) {
-	payload, err := e.erc20Wallet.withdraw(token, address, value)
+	return e.ERC20WithdrawTo(token, address, address, value)
+}
+
+func (e *env) ERC20WithdrawTo(
+	token common.Address,
+	address common.Address,
+	recipient common.Address,
+	value *big.Int,
+) (int, error) {
+	balance := e.erc20Wallet.balanceOf(token, address)
+	payload, err := e.erc20Wallet.withdraw(token, address, recipient, value)
+	if err != nil {
+		return 0, err
+	}
+	restore := e.saveFees(token, address, balance)
+	net, err := e.withdrawFee(token, address, value)
+	if err != nil {
+		restore()
+		return 0, err
+	}
+	if net.Cmp(value) != 0 {
+		payload = encodeERC20Withdraw(recipient, net)
+	}
+	index, err := e.TryVoucher(token, big.NewInt(0), payload)
+	if err != nil {
+		// restore the balance because the voucher wasn't sent
+		restore()
+		return 0, err
+	}
+	return index, nil
+}
+
+func (e *env) BatchTransfer(transfers []Transfer) error {
+	return e.batchTransfer(transfers)
+}
+
+func (e *env) BatchWithdraw(withdrawals []Withdrawal) ([]int, error) {
+	return e.batchWithdraw(withdrawals)
+}
+
+func (e *env) EtherLock(address common.Address, value *big.Int, reason string) error {
+	return e.etherWallet.lock(address, value, reason)
+}
+
+func (e *env) EtherUnlock(address common.Address, value *big.Int, reason string) error {
+	return e.etherWallet.unlock(address, value, reason)
+}
+
+func (e *env) ERC20Lock(token common.Address, address common.Address, value *big.Int, reason string) error {
+	return e.erc20Wallet.lock(token, address, value, reason)
+}
+
+func (e *env) ERC20Unlock(token common.Address, address common.Address, value *big.Int, reason string) error {
+	return e.erc20Wallet.unlock(token, address, value, reason)
+}
+
+func (e *env) NativeCreate(token NativeToken) (common.Address, error) {
+	return e.native.create(token)
+}
+
+func (e *env) NativeMint(token common.Address, address common.Address, value *big.Int) error {
+	return e.native.mint(token, address, value)
+}
+
+func (e *env) NativeBurn(token common.Address, address common.Address, value *big.Int) error {
+	return e.native.burn(token, address, value)
+}
+
+func (e *env) NativeTransfer(
+	token common.Address,
+	src common.Address,
+	dst common.Address,
+	value *big.Int,
+) error {
+	return e.native.transfer(token, src, dst, value)
+}
+
+func (e *env) NativeWithdraw(
+	token common.Address,
+	address common.Address,
+	value *big.Int,
+) (int, error) {
+	minter, payload, err := e.native.withdraw(token, address, address, value)
 	if err != nil {
 		return 0, err
 	}
-	return e.Voucher(token, big.NewInt(0), payload), nil
+	index, err := e.TryVoucher(minter, big.NewInt(0), payload)
+	if err != nil {
+		// mint the burned tokens back because the voucher wasn't sent
+		if mintErr := e.native.mint(token, address, value); mintErr != nil {
+			// impossible because the withdrawal reduced the supply by the same value
+			panic(mintErr)
+		}
+		return 0, err
+	}
+	return index, nil
 }
 
 func (e *env) SetEtherBalance(address common.Address, value *big.Int) {
-	e.etherWallet.setBalance(address, value)
+	if err := CheckValue(value); err != nil {
+		panic(err)
+	}
+	e.etherWallet.setBalance(address, new(big.Int).Set(value))
 }
 
 func (e *env) SetERC20Balance(token common.Address, address common.Address, value *big.Int) {
-	e.erc20Wallet.setBalance(token, address, value)
+	if err := CheckValue(value); err != nil {
+		panic(err)
+	}
+	e.erc20Wallet.setBalance(token, address, new(big.Int).Set(value))
+}
+
+func (e *env) ScheduleAt(timestamp int64, action ScheduledAction) int {
+	return e.scheduler.add(scheduledAction{timestamp: timestamp, action: action})
+}
+
+func (e *env) ScheduleAtBlock(blockNumber int64, action ScheduledAction) int {
+	return e.scheduler.add(scheduledAction{blockNumber: blockNumber, byBlock: true, action: action})
+}
+
+func (e *env) CancelScheduled(id int) bool {
+	return e.scheduler.cancel(id)
+}
+
+// checkEtherVoucher returns ErrUnknownAppAddress if the Ether voucher needs the application
+// address, which only happens in the v1 portal layout, and the address is unknown.
+func (e *env) checkEtherVoucher() error {
+	if e.PortalLayout == PortalLayoutV1 && e.appAddress == (common.Address{}) {
+		return ErrUnknownAppAddress
+	}
+	return nil
+}
+
+// scheduleIn adds the action scheduled by the mux application with the namespace.
+func (e *env) scheduleIn(namespace string, action scheduledAction) int {
+	action.namespace = namespace
+	return e.scheduler.add(action)
+}
+
+// scheduledIn returns the ids of the actions scheduled by the mux application with the namespace.
+func (e *env) scheduledIn(namespace string) []int {
+	return e.scheduler.pendingIn(namespace)
+}
+
+// cancelIn cancels the action if the mux application with the namespace scheduled it.
+func (e *env) cancelIn(namespace string, id int) bool {
+	return e.scheduler.cancelIn(namespace, id)
 }
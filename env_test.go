@@ -0,0 +1,272 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+// testApplication is an application that calls the given functions.
+type testApplication struct {
+	advance func(env Env, metadata Metadata, deposit Deposit, payload []byte) error
+	inspect func(env EnvInspector, payload []byte) error
+}
+
+func (a *testApplication) Advance(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+	if a.advance == nil {
+		return nil
+	}
+	return a.advance(env, metadata, deposit, payload)
+}
+
+func (a *testApplication) Inspect(env EnvInspector, payload []byte) error {
+	if a.inspect == nil {
+		return nil
+	}
+	return a.inspect(env, payload)
+}
+
+func TestAppAddressSuite(t *testing.T) {
+	suite.Run(t, new(AppAddressSuite))
+}
+
+type AppAddressSuite struct {
+	suite.Suite
+	app        *testApplication
+	appAddress common.Address
+	relay      common.Address
+	sender     common.Address
+}
+
+func (s *AppAddressSuite) SetupTest() {
+	s.app = new(testApplication)
+	s.appAddress = common.HexToAddress("0xab7528bb862fb57e8a2bcd567a2e929a0be56a5e")
+	s.relay = common.HexToAddress("0xF5DE34d6BbC0446E2a45719E718efEbaaE179daE")
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *AppAddressSuite) newTester(appAddress common.Address) *Tester {
+	opts := NewTesterOpts()
+	opts.AppAddress = appAddress
+	opts.AppAddressRelay = s.relay
+	return NewTesterWithOpts(s.app, opts)
+}
+
+func (s *AppAddressSuite) inspectAppAddress(tester *Tester) (common.Address, bool) {
+	var (
+		address common.Address
+		ok      bool
+	)
+	s.app.inspect = func(env EnvInspector, payload []byte) error {
+		address, ok = env.AppAddress()
+		return nil
+	}
+	result := tester.Inspect(nil)
+	s.Nil(result.Err)
+	return address, ok
+}
+
+func (s *AppAddressSuite) TestConfiguredAddress() {
+	tester := s.newTester(s.appAddress)
+	address, ok := s.inspectAppAddress(tester)
+	s.True(ok)
+	s.Equal(s.appAddress, address)
+}
+
+func (s *AppAddressSuite) TestUnknownAddress() {
+	tester := s.newTester(common.Address{})
+	address, ok := s.inspectAppAddress(tester)
+	s.False(ok)
+	s.Equal(common.Address{}, address)
+
+	// advance metadata without the app contract doesn't change the address
+	result := tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	_, ok = s.inspectAppAddress(tester)
+	s.False(ok)
+}
+
+func (s *AppAddressSuite) TestRelayAddress() {
+	var advanced bool
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		advanced = true
+		return nil
+	}
+	tester := s.newTester(common.Address{})
+	result := tester.RelayAppAddress(s.appAddress)
+	s.Nil(result.Err)
+	s.False(advanced)
+
+	// the address persists across inputs
+	address, ok := s.inspectAppAddress(tester)
+	s.True(ok)
+	s.Equal(s.appAddress, address)
+	result = tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.True(advanced)
+	address, ok = s.inspectAppAddress(tester)
+	s.True(ok)
+	s.Equal(s.appAddress, address)
+}
+
+func (s *AppAddressSuite) TestMalformedRelay() {
+	tester := s.newTester(common.Address{})
+	result := tester.Advance(s.relay, []byte{0xfa})
+	s.ErrorContains(result.Err, "invalid app address relay size; got 1")
+}
+
+func (s *AppAddressSuite) TestEtherWithdrawWithUnknownAddress() {
+	// the v1 voucher calls the application contract
+	book := NewAddressBook()
+	book.PortalLayout = PortalLayoutV1
+	env := newEnv(context.Background(), &rollupMock{}, s.app, envOpts{
+		book:   book,
+		logger: newPayloadLogger(slog.Default(), LogPolicy{}),
+	})
+	env.SetEtherBalance(s.sender, big.NewInt(100))
+	_, err := env.EtherWithdraw(s.sender, big.NewInt(100))
+	s.ErrorIs(err, ErrUnknownAppAddress)
+	s.Equal(big.NewInt(100), env.EtherBalanceOf(s.sender))
+}
+
+func (s *AppAddressSuite) TestEtherWithdrawV2WithUnknownAddress() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		if deposit != nil {
+			return nil
+		}
+		_, err := env.EtherWithdraw(s.sender, big.NewInt(100))
+		return err
+	}
+	opts := NewTesterOpts()
+	opts.AppAddress = common.Address{}
+	opts.AppAddressRelay = s.relay
+	opts.PortalLayout = PortalLayoutV2
+	tester := NewTesterWithOpts(s.app, opts)
+	s.Require().Nil(tester.DepositEther(s.sender, big.NewInt(100), nil).Err)
+	result := tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(s.sender, result.Vouchers[0].Destination)
+	s.Equal(big.NewInt(100), result.Vouchers[0].Value)
+	s.Equal(big.NewInt(0), tester.env.EtherBalanceOf(s.sender))
+}
+
+func (s *AppAddressSuite) TestRunDoesNotSnapshot() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.SetEtherBalance(s.sender, big.NewInt(100))
+		return errors.New("reject")
+	}
+	env := newEnv(context.Background(), &rollupMock{}, s.app, envOpts{
+		book:   NewAddressBook(),
+		logger: newPayloadLogger(slog.Default(), LogPolicy{}),
+	})
+	err := env.handle(context.Background(), &advanceInput{Metadata: Metadata{MsgSender: s.sender}})
+	s.ErrorContains(err, "reject")
+	// the Cartesi Machine reverts the state, so the env doesn't copy it
+	s.Equal(big.NewInt(100), env.EtherBalanceOf(s.sender))
+}
+
+func TestOutputErrorSuite(t *testing.T) {
+	suite.Run(t, new(OutputErrorSuite))
+}
+
+type OutputErrorSuite struct {
+	suite.Suite
+	app    *testApplication
+	tester *Tester
+	sender common.Address
+	token  common.Address
+	err    error
+}
+
+func (s *OutputErrorSuite) SetupTest() {
+	s.app = new(testApplication)
+	s.tester = NewTester(s.app)
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.token = common.HexToAddress("0xfbfbfbfbfbfbfbfbfbfbfbfbfbfbfbfbfbfbfbfb")
+	s.err = errors.New("rollup: do request: connection refused")
+}
+
+func (s *OutputErrorSuite) TestTryVariants() {
+	var errs []error
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		_, err := env.TryVoucher(s.sender, big.NewInt(0), payload)
+		errs = append(errs, err)
+		_, err = env.TryDelegateCallVoucher(s.sender, payload)
+		errs = append(errs, err)
+		_, err = env.TryNotice(payload)
+		errs = append(errs, err)
+		errs = append(errs, env.TryReport(payload))
+		return nil
+	}
+	for _, route := range []string{
+		LogRouteVoucher, LogRouteDelegateCallVoucher, LogRouteNotice, LogRouteReport,
+	} {
+		s.tester.InjectFault(TestFault{Route: route, Err: s.err})
+	}
+	result := s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Equal([]error{s.err, s.err, s.err, s.err}, errs)
+	s.Empty(result.Vouchers)
+	s.Empty(result.DelegateCallVouchers)
+	s.Empty(result.Notices)
+	s.Empty(result.Reports)
+}
+
+func (s *OutputErrorSuite) TestFallback() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		if _, err := env.TryNotice(payload); err != nil {
+			env.Report([]byte(err.Error()))
+		}
+		return nil
+	}
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Err: s.err})
+	result := s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Equal([]TestReport{{Payload: []byte(s.err.Error())}}, result.Reports)
+
+	// the mock stops failing
+	s.tester.ClearFaults()
+	result = s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Len(result.Notices, 1)
+	s.Empty(result.Reports)
+}
+
+func (s *OutputErrorSuite) TestPanickingVariant() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Notice(payload)
+		return nil
+	}
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Err: s.err})
+	result := s.tester.Advance(s.sender, nil)
+	s.Equal(s.err, result.Err)
+}
+
+func (s *OutputErrorSuite) TestWithdrawKeepsBalance() {
+	var etherErr, erc20Err error
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		if deposit != nil {
+			return nil
+		}
+		_, etherErr = env.EtherWithdraw(s.sender, big.NewInt(100))
+		_, erc20Err = env.ERC20Withdraw(s.token, s.sender, big.NewInt(50))
+		return nil
+	}
+	s.Nil(s.tester.DepositEther(s.sender, big.NewInt(100), nil).Err)
+	s.Nil(s.tester.DepositERC20(s.token, s.sender, big.NewInt(50), nil).Err)
+	s.tester.InjectFault(TestFault{Route: LogRouteVoucher, Err: s.err})
+	s.Nil(s.tester.Advance(s.sender, nil).Err)
+	s.Equal(s.err, etherErr)
+	s.Equal(s.err, erc20Err)
+	s.Equal(big.NewInt(100), s.tester.env.EtherBalanceOf(s.sender))
+	s.Equal(big.NewInt(50), s.tester.env.ERC20BalanceOf(s.token, s.sender))
+}
@@ -28,9 +28,9 @@ type ERC20Deposit struct {
 	Value *big.Int
 }
 
+// String formats the value with the default token registry, such as "1.5 TEST".
 func (d *ERC20Deposit) String() string {
-	value := d.Value.String()
-	return fmt.Sprintf("%v deposited %v of %v token", d.Sender, value, d.Token)
+	return fmt.Sprintf("%v deposited %v", d.Sender, defaultTokenRegistry.Format(d.Token, d.Value))
 }
 
 // erc20Wallet /////////////////////////////////////////////////////////////////////////////////////
@@ -38,11 +38,16 @@ func (d *ERC20Deposit) String() string {
 // erc20Wallet is a wallet that manages ERC20 tokens.
 type erc20Wallet struct {
 	balance map[common.Address]map[common.Address]big.Int
+	locks   *lockTable
+	layout  PortalLayout
+	logger  *payloadLogger
 }
 
 func newErc20Wallet() *erc20Wallet {
 	return &erc20Wallet{
 		balance: make(map[common.Address]map[common.Address]big.Int),
+		locks:   newLockTable(),
+		logger:  newPayloadLogger(slog.Default(), LogPolicy{}),
 	}
 }
 
@@ -85,22 +90,56 @@ func (w *erc20Wallet) balanceOf(token common.Address, address common.Address) *b
 	return &balance
 }
 
+// availableOf returns the balance of the address that isn't locked.
+func (w *erc20Wallet) availableOf(token common.Address, address common.Address) *big.Int {
+	return w.locks.available(token, address, w.balanceOf(token, address))
+}
+
+func (w *erc20Wallet) lock(token common.Address, address common.Address, value *big.Int, reason string) error {
+	return w.locks.lock(token, address, w.balanceOf(token, address), reason, value)
+}
+
+func (w *erc20Wallet) unlock(token common.Address, address common.Address, value *big.Int, reason string) error {
+	return w.locks.unlock(token, address, reason, value)
+}
+
+// snapshot returns a copy of the balances.
+func (w *erc20Wallet) snapshot() map[common.Address]map[common.Address]big.Int {
+	balance := make(map[common.Address]map[common.Address]big.Int, len(w.balance))
+	for token, tokenBalance := range w.balance {
+		balance[token] = make(map[common.Address]big.Int, len(tokenBalance))
+		for address, value := range tokenBalance {
+			balance[token][address] = *new(big.Int).Set(&value)
+		}
+	}
+	return balance
+}
+
+// restore replaces the balances with the snapshot.
+func (w *erc20Wallet) restore(balance map[common.Address]map[common.Address]big.Int) {
+	w.balance = balance
+}
+
 func (w *erc20Wallet) transfer(
 	token common.Address,
 	src common.Address,
 	dst common.Address,
 	value *big.Int,
 ) error {
+	if err := CheckValue(value); err != nil {
+		return err
+	}
 	if src == dst {
-		return fmt.Errorf("can't transfer to self")
+		return ErrSelfTransfer
 	}
-	newSrcBalance := new(big.Int).Sub(w.balanceOf(token, src), value)
-	if newSrcBalance.Sign() < 0 {
-		return fmt.Errorf("insuficient funds")
+	if available := w.availableOf(token, src); available.Cmp(value) < 0 {
+		return &InsufficientFundsError{Asset: token, Account: src, Have: available, Want: value}
 	}
-	newDstBalance := new(big.Int).Add(w.balanceOf(token, dst), value)
+	newSrcBalance := new(big.Int).Sub(w.balanceOf(token, src), value)
+	dstBalance := w.balanceOf(token, dst)
+	newDstBalance := new(big.Int).Add(dstBalance, value)
 	if newDstBalance.Cmp(MaxUint256) > 0 {
-		return fmt.Errorf("balance overflow")
+		return &BalanceOverflowError{Asset: token, Account: dst, Balance: dstBalance, Value: value}
 	}
 
 	// commit
@@ -109,48 +148,44 @@ func (w *erc20Wallet) transfer(
 	return nil
 }
 
+// withdraw debits the tokens from the address and returns the payload of the voucher that
+// transfers them to the recipient.
 func (w *erc20Wallet) withdraw(
 	token common.Address,
 	address common.Address,
+	recipient common.Address,
 	value *big.Int,
 ) ([]byte, error) {
-	newBalance := new(big.Int).Sub(w.balanceOf(token, address), value)
-	if newBalance.Sign() < 0 {
-		return nil, fmt.Errorf("insuficient funds")
+	if err := CheckValue(value); err != nil {
+		return nil, err
 	}
-	w.setBalance(token, address, newBalance)
-	return encodeERC20Withdraw(address, value), nil
+	if available := w.availableOf(token, address); available.Cmp(value) < 0 {
+		return nil, &InsufficientFundsError{Asset: token, Account: address, Have: available, Want: value}
+	}
+	w.setBalance(token, address, new(big.Int).Sub(w.balanceOf(token, address), value))
+	return encodeERC20Withdraw(recipient, value), nil
 }
 
 func (w *erc20Wallet) deposit(payload []byte) (Deposit, []byte, error) {
-	if len(payload) < 20+20+32 {
-		return nil, nil, fmt.Errorf("invalid erc20 deposit size; got %v", len(payload))
+	deposit, payload, err := w.layout.DecodeERC20Deposit(payload)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	token := common.BytesToAddress(payload[:20])
-	payload = payload[20:]
-
-	sender := common.BytesToAddress(payload[:20])
-	payload = payload[20:]
-
-	value := new(big.Int).SetBytes(payload[:32])
-	payload = payload[32:]
-
-	newBalance := new(big.Int).Add(w.balanceOf(token, sender), value)
+	newBalance := new(big.Int).Add(w.balanceOf(deposit.Token, deposit.Sender), deposit.Value)
 	if newBalance.Cmp(MaxUint256) > 0 {
 		// This should not be possible in real world, but we handle it anyway.
-		slog.Warn("overflow erc20 balance", "account", sender)
+		w.logger.Warn("overflow erc20 balance", "account", deposit.Sender)
 		newBalance = MaxUint256
 	}
-	w.setBalance(token, sender, newBalance)
+	w.setBalance(deposit.Token, deposit.Sender, newBalance)
 
-	deposit := &ERC20Deposit{token, sender, value}
 	return deposit, payload, nil
 }
 
 // auxiliary functions /////////////////////////////////////////////////////////////////////////////
 
-// encodeERC20Withdraw encodes the voucher to withdraw the asset from the portal.
+// encodeERC20Withdraw encodes the voucher that transfers the tokens to the address.
 func encodeERC20Withdraw(address common.Address, value *big.Int) []byte {
 	abiJson := `[{
 		"type": "function",
@@ -39,6 +39,12 @@ func (s *ERC20WalletSuite) TestDepositString() {
 	expectedString := "0xFafafAfafAFaFAFaFafafafAfaFaFAfAfAfAFaFA deposited 123 of " +
 		"0xBAbAbabAbabaBABaBAbABabaBAbAbaBaBAbABaBa token"
 	s.Equal(expectedString, deposit.String())
+
+	// the test token of the default address book
+	value = big.NewInt(1500000000000000000)
+	deposit = &ERC20Deposit{NewAddressBook().TestToken, s.src, value}
+	expectedString = "0xFafafAfafAFaFAFaFafafafAfaFaFAfAfAfAFaFA deposited 1.5 TEST"
+	s.Equal(expectedString, deposit.String())
 }
 
 func (s *ERC20WalletSuite) TestTokens() {
@@ -126,25 +132,44 @@ func (s *ERC20WalletSuite) TestZeroTransfer() {
 func (s *ERC20WalletSuite) TestSelfTransfer() {
 	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(50))
 	err := s.wallet.transfer(s.tokens[0], s.src, s.src, big.NewInt(50))
-	s.ErrorContains(err, "can't transfer to self")
+	s.ErrorIs(err, ErrSelfTransfer)
 }
 
-func (s *ERC20WalletSuite) TestInsuficientFundsTransfer() {
+func (s *ERC20WalletSuite) TestInsufficientFundsTransfer() {
 	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(50))
 	err := s.wallet.transfer(s.tokens[0], s.src, s.dst, big.NewInt(100))
-	s.ErrorContains(err, "insuficient funds")
+	s.ErrorIs(err, ErrInsufficientFunds)
+	var fundsErr *InsufficientFundsError
+	s.Require().ErrorAs(err, &fundsErr)
+	s.Equal(s.tokens[0], fundsErr.Asset)
+	s.Equal(s.src, fundsErr.Account)
+	s.Equal(big.NewInt(50), fundsErr.Have)
+	s.Equal(big.NewInt(100), fundsErr.Want)
 }
 
 func (s *ERC20WalletSuite) TestBalanceOverflowTransfer() {
 	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(50))
 	s.wallet.setBalance(s.tokens[0], s.dst, MaxUint256)
 	err := s.wallet.transfer(s.tokens[0], s.src, s.dst, big.NewInt(50))
-	s.ErrorContains(err, "balance overflow")
+	s.ErrorIs(err, ErrBalanceOverflow)
+	var overflowErr *BalanceOverflowError
+	s.Require().ErrorAs(err, &overflowErr)
+	s.Equal(s.tokens[0], overflowErr.Asset)
+	s.Equal(s.dst, overflowErr.Account)
+}
+
+func (s *ERC20WalletSuite) TestInvalidValueTransfer() {
+	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(50))
+	err := s.wallet.transfer(s.tokens[0], s.src, s.dst, big.NewInt(-10))
+	s.ErrorIs(err, ErrInvalidValue)
+	err = s.wallet.transfer(s.tokens[0], s.src, s.dst, nil)
+	s.ErrorIs(err, ErrInvalidValue)
+	s.Equal(big.NewInt(50), s.wallet.balanceOf(s.tokens[0], s.src))
 }
 
 func (s *ERC20WalletSuite) TestValidWithdraw() {
 	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(100))
-	voucher, err := s.wallet.withdraw(s.tokens[0], s.src, big.NewInt(100))
+	voucher, err := s.wallet.withdraw(s.tokens[0], s.src, s.src, big.NewInt(100))
 	s.Nil(err)
 	expected := common.Hex2Bytes("a9059cbb000000000000000000000000fafafafafafafafafafafafafafafafafafafafa0000000000000000000000000000000000000000000000000000000000000064")
 	s.Equal(expected, voucher)
@@ -152,14 +177,22 @@ func (s *ERC20WalletSuite) TestValidWithdraw() {
 	s.Equal(big.NewInt(0), balance)
 }
 
-func (s *ERC20WalletSuite) TestInsuficientFundsWithdraw() {
+func (s *ERC20WalletSuite) TestInsufficientFundsWithdraw() {
 	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(50))
-	_, err := s.wallet.withdraw(s.tokens[0], s.src, big.NewInt(100))
-	s.ErrorContains(err, "insuficient funds")
+	_, err := s.wallet.withdraw(s.tokens[0], s.src, s.src, big.NewInt(100))
+	s.ErrorIs(err, ErrInsufficientFunds)
 	balance := s.wallet.balanceOf(s.tokens[0], s.src)
 	s.Equal(big.NewInt(50), balance)
 }
 
+func (s *ERC20WalletSuite) TestInvalidValueWithdraw() {
+	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(50))
+	_, err := s.wallet.withdraw(s.tokens[0], s.src, s.src, nil)
+	s.ErrorIs(err, ErrInvalidValue)
+	s.ErrorContains(err, "invalid value: nil")
+	s.Equal(big.NewInt(50), s.wallet.balanceOf(s.tokens[0], s.src))
+}
+
 func (s *ERC20WalletSuite) TestValidDeposit() {
 	payload := common.Hex2Bytes("babababababababababababababababababababafafafafafafafafafafafafafafafafafafafafa0000000000000000000000000000000000000000000000000000000000000064deadbeef")
 	deposit, input, err := s.wallet.deposit(payload)
@@ -209,3 +242,23 @@ func (s *ERC20WalletSuite) TestMalformedDeposit() {
 	_, _, err := s.wallet.deposit(payload)
 	s.ErrorContains(err, "invalid erc20 deposit size; got 3")
 }
+
+func (s *ERC20WalletSuite) TestLock() {
+	s.wallet.setBalance(s.tokens[0], s.src, big.NewInt(100))
+	s.wallet.setBalance(s.tokens[1], s.src, big.NewInt(100))
+	s.Nil(s.wallet.lock(s.tokens[0], s.src, big.NewInt(60), "auction"))
+	s.Equal(big.NewInt(40), s.wallet.availableOf(s.tokens[0], s.src))
+	s.Equal(big.NewInt(100), s.wallet.availableOf(s.tokens[1], s.src))
+	s.Equal([]Lock{{"auction", big.NewInt(60)}}, s.wallet.locks.list(s.tokens[0], s.src))
+
+	err := s.wallet.transfer(s.tokens[0], s.src, s.dst, big.NewInt(41))
+	s.ErrorIs(err, ErrInsufficientFunds)
+	_, err = s.wallet.withdraw(s.tokens[0], s.src, s.src, big.NewInt(41))
+	s.ErrorIs(err, ErrInsufficientFunds)
+	s.Nil(s.wallet.transfer(s.tokens[1], s.src, s.dst, big.NewInt(100)))
+
+	err = s.wallet.unlock(s.tokens[1], s.src, big.NewInt(1), "auction")
+	s.ErrorIs(err, ErrInsufficientLocked)
+	s.Nil(s.wallet.unlock(s.tokens[0], s.src, big.NewInt(60), "auction"))
+	s.Equal(big.NewInt(100), s.wallet.availableOf(s.tokens[0], s.src))
+}
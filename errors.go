@@ -0,0 +1,175 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrUnknownAppAddress is returned when an operation requires the application address, but
+// Rollmelette didn't receive it yet.
+var ErrUnknownAppAddress = errors.New("unknown application address")
+
+// ErrInsufficientFunds is matched by InsufficientFundsError.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// ErrInsufficientLocked is matched by InsufficientLockedError.
+var ErrInsufficientLocked = errors.New("insufficient locked funds")
+
+// ErrBalanceOverflow is matched by BalanceOverflowError.
+var ErrBalanceOverflow = errors.New("balance overflow")
+
+// ErrSelfTransfer is returned when the source and destination of a transfer are the same.
+var ErrSelfTransfer = errors.New("can't transfer to self")
+
+// ErrInvalidValue is matched by InvalidValueError.
+var ErrInvalidValue = errors.New("invalid value")
+
+// ErrOutputLimit is matched by OutputLimitError.
+var ErrOutputLimit = errors.New("output limit exceeded")
+
+// ErrUnknownToken is returned when an operation uses a native token that doesn't exist.
+var ErrUnknownToken = errors.New("unknown token")
+
+// ErrInvalidToken is returned when a native token can't be created or withdrawn.
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrInvalidFeePolicy is returned when the fee policy has an invalid rule.
+var ErrInvalidFeePolicy = errors.New("invalid fee policy")
+
+// ErrNoRoute is returned by the Mux when no application matches the input.
+var ErrNoRoute = errors.New("no application for input")
+
+// ErrNamespaceViolation is returned when an application hosted by the Mux changes the state of
+// another application.
+var ErrNamespaceViolation = errors.New("namespace violation")
+
+// InsufficientFundsError is returned when an account doesn't have enough funds for an operation.
+// Asset is the token address, or the zero address for Ether.
+type InsufficientFundsError struct {
+	Asset   common.Address
+	Account common.Address
+	Have    *big.Int
+	Want    *big.Int
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("%v: %v has %v of %v; want %v",
+		ErrInsufficientFunds, e.Account, e.Have, assetString(e.Asset), e.Want)
+}
+
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+// InsufficientLockedError is returned when an account doesn't have enough funds locked for the
+// reason. Asset is the token address, or the zero address for Ether.
+type InsufficientLockedError struct {
+	Asset   common.Address
+	Account common.Address
+	Reason  string
+	Have    *big.Int
+	Want    *big.Int
+}
+
+func (e *InsufficientLockedError) Error() string {
+	return fmt.Sprintf("%v: %v has %v of %v locked for %q; want %v",
+		ErrInsufficientLocked, e.Account, e.Have, assetString(e.Asset), e.Reason, e.Want)
+}
+
+func (e *InsufficientLockedError) Is(target error) bool {
+	return target == ErrInsufficientLocked
+}
+
+// BalanceOverflowError is returned when an operation would make a balance exceed MaxUint256.
+// Asset is the token address, or the zero address for Ether.
+type BalanceOverflowError struct {
+	Asset   common.Address
+	Account common.Address
+	Balance *big.Int
+	Value   *big.Int
+}
+
+func (e *BalanceOverflowError) Error() string {
+	return fmt.Sprintf("%v: %v has %v of %v; can't receive %v",
+		ErrBalanceOverflow, e.Account, e.Balance, assetString(e.Asset), e.Value)
+}
+
+func (e *BalanceOverflowError) Is(target error) bool {
+	return target == ErrBalanceOverflow
+}
+
+// InvalidValueError is returned when a wallet operation receives a nil, negative, or too big value.
+type InvalidValueError struct {
+	Value *big.Int
+}
+
+func (e *InvalidValueError) Error() string {
+	switch {
+	case e.Value == nil:
+		return fmt.Sprintf("%v: nil", ErrInvalidValue)
+	case e.Value.Sign() < 0:
+		return fmt.Sprintf("%v: negative value %v", ErrInvalidValue, e.Value)
+	default:
+		return fmt.Sprintf("%v: %v is greater than MaxUint256", ErrInvalidValue, e.Value)
+	}
+}
+
+func (e *InvalidValueError) Is(target error) bool {
+	return target == ErrInvalidValue
+}
+
+// BatchTransferError is returned when a leg of a batch transfer fails.
+// Leg is the index of the failing transfer, and Err is its error.
+type BatchTransferError struct {
+	Leg int
+	Err error
+}
+
+func (e *BatchTransferError) Error() string {
+	return fmt.Sprintf("batch transfer leg %v: %v", e.Leg, e.Err)
+}
+
+func (e *BatchTransferError) Unwrap() error {
+	return e.Err
+}
+
+// OutputLimitError is returned when an output exceeds the OutputLimits.
+// Route is the log route of the output, such as LogRouteNotice.
+// Limit is either "payload bytes" or "outputs".
+type OutputLimitError struct {
+	Route string
+	Limit string
+	Value int
+	Max   int
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("%v: %v has %v %v; max %v", ErrOutputLimit, e.Route, e.Value, e.Limit, e.Max)
+}
+
+func (e *OutputLimitError) Is(target error) bool {
+	return target == ErrOutputLimit
+}
+
+// CheckValue returns an InvalidValueError if the value is nil, negative, or doesn't fit in an
+// uint256, so it can't be used in a wallet operation.
+func CheckValue(value *big.Int) error {
+	if value == nil || value.Sign() < 0 || value.Cmp(MaxUint256) > 0 {
+		return &InvalidValueError{value}
+	}
+	return nil
+}
+
+// assetString returns the name of the asset used in error messages.
+func assetString(asset common.Address) string {
+	if asset == (common.Address{}) {
+		return "Ether"
+	}
+	return asset.String()
+}
@@ -5,10 +5,13 @@ package rollmelette
 
 import (
 	"fmt"
+	"log"
 	"log/slog"
 	"math/big"
 	"slices"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -24,8 +27,7 @@ type EtherDeposit struct {
 }
 
 func (d *EtherDeposit) String() string {
-	value := etherString(d.Value)
-	return fmt.Sprintf("%v deposited %v Ether", d.Sender, value)
+	return fmt.Sprintf("%v deposited %v Ether", d.Sender, FormatUnits(d.Value, EtherDecimals))
 }
 
 // etherWallet /////////////////////////////////////////////////////////////////////////////////////
@@ -33,11 +35,16 @@ func (d *EtherDeposit) String() string {
 // etherWallet is a wallet that manages Ether deposits.
 type etherWallet struct {
 	balance map[common.Address]big.Int
+	locks   *lockTable
+	layout  PortalLayout
+	logger  *payloadLogger
 }
 
 func newEtherWallet() *etherWallet {
 	return &etherWallet{
 		balance: make(map[common.Address]big.Int),
+		locks:   newLockTable(),
+		logger:  newPayloadLogger(slog.Default(), LogPolicy{}),
 	}
 }
 
@@ -63,42 +70,67 @@ func (w *etherWallet) balanceOf(address common.Address) *big.Int {
 	return &balance
 }
 
-func (w *etherWallet) deposit(payload []byte) (Deposit, []byte, error) {
-	if len(payload) < 20+32 {
-		return nil, nil, fmt.Errorf("invalid eth deposit size; got %v", len(payload))
+// availableOf returns the balance of the address that isn't locked.
+func (w *etherWallet) availableOf(address common.Address) *big.Int {
+	return w.locks.available(common.Address{}, address, w.balanceOf(address))
+}
+
+func (w *etherWallet) lock(address common.Address, value *big.Int, reason string) error {
+	return w.locks.lock(common.Address{}, address, w.balanceOf(address), reason, value)
+}
+
+func (w *etherWallet) unlock(address common.Address, value *big.Int, reason string) error {
+	return w.locks.unlock(common.Address{}, address, reason, value)
+}
+
+// snapshot returns a copy of the balances.
+func (w *etherWallet) snapshot() map[common.Address]big.Int {
+	balance := make(map[common.Address]big.Int, len(w.balance))
+	for address, value := range w.balance {
+		balance[address] = *new(big.Int).Set(&value)
 	}
+	return balance
+}
 
-	sender := common.BytesToAddress(payload[:20])
-	payload = payload[20:]
+// restore replaces the balances with the snapshot.
+func (w *etherWallet) restore(balance map[common.Address]big.Int) {
+	w.balance = balance
+}
 
-	value := new(big.Int).SetBytes(payload[:32])
-	payload = payload[32:]
+func (w *etherWallet) deposit(payload []byte) (Deposit, []byte, error) {
+	deposit, payload, err := w.layout.DecodeEtherDeposit(payload)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	newBalance := new(big.Int).Add(w.balanceOf(sender), value)
+	newBalance := new(big.Int).Add(w.balanceOf(deposit.Sender), deposit.Value)
 	if newBalance.Cmp(MaxUint256) > 0 {
 		// This should not be possible in real world, but we handle it anyway.
-		slog.Warn("overflow ether balance", "account", sender)
+		w.logger.Warn("overflow ether balance", "account", deposit.Sender)
 		newBalance = MaxUint256
 	}
-	w.setBalance(sender, newBalance)
+	w.setBalance(deposit.Sender, newBalance)
 
-	deposit := &EtherDeposit{sender, value}
 	return deposit, payload, nil
 }
 
 func (w *etherWallet) transfer(src common.Address, dst common.Address, value *big.Int) error {
+	if err := CheckValue(value); err != nil {
+		return err
+	}
 	if src == dst {
-		return fmt.Errorf("can't transfer to self")
+		return ErrSelfTransfer
 	}
 
-	newSrcBalance := new(big.Int).Sub(w.balanceOf(src), value)
-	if newSrcBalance.Sign() < 0 {
-		return fmt.Errorf("insuficient funds")
+	if available := w.availableOf(src); available.Cmp(value) < 0 {
+		return &InsufficientFundsError{Account: src, Have: available, Want: value}
 	}
+	newSrcBalance := new(big.Int).Sub(w.balanceOf(src), value)
 
-	newDstBalance := new(big.Int).Add(w.balanceOf(dst), value)
+	dstBalance := w.balanceOf(dst)
+	newDstBalance := new(big.Int).Add(dstBalance, value)
 	if newDstBalance.Cmp(MaxUint256) > 0 {
-		return fmt.Errorf("balance overflow")
+		return &BalanceOverflowError{Account: dst, Balance: dstBalance, Value: value}
 	}
 
 	// commit
@@ -108,23 +140,54 @@ func (w *etherWallet) transfer(src common.Address, dst common.Address, value *bi
 }
 
 func (w *etherWallet) withdraw(address common.Address, value *big.Int) error {
-	newBalance := new(big.Int).Sub(w.balanceOf(address), value)
-	if newBalance.Sign() < 0 {
-		return fmt.Errorf("insuficient funds")
+	if err := CheckValue(value); err != nil {
+		return err
+	}
+	if available := w.availableOf(address); available.Cmp(value) < 0 {
+		return &InsufficientFundsError{Account: address, Have: available, Want: value}
 	}
-	w.setBalance(address, newBalance)
+	w.setBalance(address, new(big.Int).Sub(w.balanceOf(address), value))
 	return nil
 }
 
 // auxiliary functions /////////////////////////////////////////////////////////////////////////////
 
-// etherString generates a string with the Ether value given the Wei value.
-func etherString(wei *big.Int) string {
-	const weiPerEther = 1e18
-	const etherDecimal = 18
-	weiFloat := new(big.Float).SetInt(wei)
-	etherFloat := new(big.Float).Quo(weiFloat, big.NewFloat(weiPerEther))
-	return etherFloat.Text('f', etherDecimal)
+// etherVoucher returns the destination, value, and payload of the voucher that sends the
+// withdrawn Ether to the recipient.
+// In V1, the voucher calls the withdrawal function of the application contract. In later
+// releases, the vouchers carry Ether, so the voucher sends the value to the recipient.
+func etherVoucher(
+	layout PortalLayout,
+	appAddress common.Address,
+	recipient common.Address,
+	value *big.Int,
+) (common.Address, *big.Int, []byte) {
+	if layout == PortalLayoutV1 {
+		return appAddress, big.NewInt(0), encodeEtherWithdraw(recipient, value)
+	}
+	return recipient, new(big.Int).Set(value), nil
+}
+
+// encodeEtherWithdraw encodes the voucher that calls the withdrawal function of the application
+// contract, which sends the Ether to the address.
+func encodeEtherWithdraw(address common.Address, value *big.Int) []byte {
+	abiJson := `[{
+		"type": "function",
+		"name": "withdrawEther",
+		"inputs": [
+			{"type": "address"},
+			{"type": "uint256"}
+		]
+	}]`
+	abiInterface, err := abi.JSON(strings.NewReader(abiJson))
+	if err != nil {
+		log.Panicf("failed to decode ABI: %v", err)
+	}
+	voucher, err := abiInterface.Pack("withdrawEther", address, value)
+	if err != nil {
+		log.Panicf("failed to pack: %v", err)
+	}
+	return voucher
 }
 
 // sortAddresses sorts a slice of addresses.
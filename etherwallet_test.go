@@ -31,7 +31,7 @@ func (s *EtherWalletSuite) SetupTest() {
 func (s *EtherWalletSuite) TestDepositString() {
 	value := big.NewInt(123000000000000000)
 	deposit := &EtherDeposit{s.src, value}
-	expected := "0xFafafAfafAFaFAFaFafafafAfaFaFAfAfAfAFaFA deposited 0.123000000000000000 Ether"
+	expected := "0xFafafAfafAFaFAFaFafafafAfaFaFAfAfAfAFaFA deposited 0.123 Ether"
 	s.Equal(expected, deposit.String())
 }
 
@@ -85,30 +85,58 @@ func (s *EtherWalletSuite) TestZeroTransfer() {
 func (s *EtherWalletSuite) TestSelfTransfer() {
 	s.wallet.setBalance(s.src, big.NewInt(50))
 	err := s.wallet.transfer(s.src, s.src, big.NewInt(50))
-	s.ErrorContains(err, "can't transfer to self")
+	s.ErrorIs(err, ErrSelfTransfer)
 }
 
-func (s *EtherWalletSuite) TestInsuficientFundsTransfer() {
+func (s *EtherWalletSuite) TestInsufficientFundsTransfer() {
 	s.wallet.setBalance(s.src, big.NewInt(50))
 	err := s.wallet.transfer(s.src, s.dst, big.NewInt(100))
-	s.ErrorContains(err, "insuficient funds")
+	s.ErrorIs(err, ErrInsufficientFunds)
+	var fundsErr *InsufficientFundsError
+	s.Require().ErrorAs(err, &fundsErr)
+	s.Equal(common.Address{}, fundsErr.Asset)
+	s.Equal(s.src, fundsErr.Account)
+	s.Equal(big.NewInt(50), fundsErr.Have)
+	s.Equal(big.NewInt(100), fundsErr.Want)
+	s.ErrorContains(err, "insufficient funds: "+s.src.String()+" has 50 of Ether; want 100")
 }
 
 func (s *EtherWalletSuite) TestBalanceOverflowTransfer() {
 	s.wallet.setBalance(s.src, big.NewInt(50))
 	s.wallet.setBalance(s.dst, MaxUint256)
 	err := s.wallet.transfer(s.src, s.dst, big.NewInt(50))
-	s.ErrorContains(err, "balance overflow")
+	s.ErrorIs(err, ErrBalanceOverflow)
+	var overflowErr *BalanceOverflowError
+	s.Require().ErrorAs(err, &overflowErr)
+	s.Equal(s.dst, overflowErr.Account)
 }
 
-func (s *EtherWalletSuite) TestInsuficientFundsWithdraw() {
+func (s *EtherWalletSuite) TestInvalidValueTransfer() {
+	s.wallet.setBalance(s.src, big.NewInt(50))
+	err := s.wallet.transfer(s.src, s.dst, big.NewInt(-10))
+	s.ErrorIs(err, ErrInvalidValue)
+	err = s.wallet.transfer(s.src, s.dst, nil)
+	s.ErrorIs(err, ErrInvalidValue)
+	s.Equal(big.NewInt(50), s.wallet.balanceOf(s.src))
+	s.Equal(big.NewInt(0), s.wallet.balanceOf(s.dst))
+}
+
+func (s *EtherWalletSuite) TestInsufficientFundsWithdraw() {
 	s.wallet.setBalance(s.src, big.NewInt(50))
 	err := s.wallet.withdraw(s.src, big.NewInt(100))
-	s.ErrorContains(err, "insuficient funds")
+	s.ErrorIs(err, ErrInsufficientFunds)
 	balance := s.wallet.balanceOf(s.src)
 	s.Equal(big.NewInt(50), balance)
 }
 
+func (s *EtherWalletSuite) TestInvalidValueWithdraw() {
+	s.wallet.setBalance(s.src, big.NewInt(50))
+	err := s.wallet.withdraw(s.src, big.NewInt(-50))
+	s.ErrorIs(err, ErrInvalidValue)
+	s.ErrorContains(err, "invalid value: negative value -50")
+	s.Equal(big.NewInt(50), s.wallet.balanceOf(s.src))
+}
+
 func (s *EtherWalletSuite) TestValidWithdraw() {
 	s.wallet.setBalance(s.src, big.NewInt(100))
 	err := s.wallet.withdraw(s.src, big.NewInt(100))
@@ -162,3 +190,74 @@ func (s *EtherWalletSuite) TestMalformedDeposit() {
 	_, _, err := s.wallet.deposit(payload)
 	s.ErrorContains(err, "invalid eth deposit size; got 3")
 }
+
+func (s *EtherWalletSuite) TestVoucher() {
+	app := common.HexToAddress("0xab7528bb862fb57e8a2bcd567a2e929a0be56a5e")
+	value := big.NewInt(100)
+
+	destination, voucherValue, payload := etherVoucher(PortalLayoutV1, app, s.dst, value)
+	s.Equal(app, destination)
+	s.Equal(big.NewInt(0), voucherValue)
+	s.Equal(encodeEtherWithdraw(s.dst, value), payload)
+
+	for _, layout := range []PortalLayout{PortalLayoutV2, PortalLayoutLayerData} {
+		destination, voucherValue, payload = etherVoucher(layout, app, s.dst, value)
+		s.Equal(s.dst, destination, layout)
+		s.Equal(value, voucherValue, layout)
+		s.Empty(payload, layout)
+	}
+}
+
+func (s *EtherWalletSuite) TestLock() {
+	s.wallet.setBalance(s.src, big.NewInt(100))
+	s.Nil(s.wallet.lock(s.src, big.NewInt(30), "auction"))
+	s.Nil(s.wallet.lock(s.src, big.NewInt(20), "bid"))
+	s.Nil(s.wallet.lock(s.src, big.NewInt(10), "auction"))
+	s.Equal(big.NewInt(100), s.wallet.balanceOf(s.src))
+	s.Equal(big.NewInt(40), s.wallet.availableOf(s.src))
+	s.Equal(big.NewInt(60), s.wallet.locks.total(common.Address{}, s.src))
+	s.Equal([]Lock{{"auction", big.NewInt(40)}, {"bid", big.NewInt(20)}},
+		s.wallet.locks.list(common.Address{}, s.src))
+
+	err := s.wallet.lock(s.src, big.NewInt(41), "bid")
+	s.ErrorIs(err, ErrInsufficientFunds)
+	s.Equal(big.NewInt(40), err.(*InsufficientFundsError).Have)
+}
+
+func (s *EtherWalletSuite) TestLockedTransferAndWithdraw() {
+	s.wallet.setBalance(s.src, big.NewInt(100))
+	s.Nil(s.wallet.lock(s.src, big.NewInt(60), "auction"))
+
+	err := s.wallet.transfer(s.src, s.dst, big.NewInt(41))
+	s.ErrorIs(err, ErrInsufficientFunds)
+	err = s.wallet.withdraw(s.src, big.NewInt(41))
+	s.ErrorIs(err, ErrInsufficientFunds)
+
+	s.Nil(s.wallet.transfer(s.src, s.dst, big.NewInt(40)))
+	s.Equal(big.NewInt(60), s.wallet.balanceOf(s.src))
+	s.Equal(big.NewInt(0), s.wallet.availableOf(s.src))
+}
+
+func (s *EtherWalletSuite) TestUnlock() {
+	s.wallet.setBalance(s.src, big.NewInt(100))
+	s.Nil(s.wallet.lock(s.src, big.NewInt(60), "auction"))
+
+	err := s.wallet.unlock(s.src, big.NewInt(10), "bid")
+	s.ErrorIs(err, ErrInsufficientLocked)
+	err = s.wallet.unlock(s.src, big.NewInt(61), "auction")
+	s.ErrorIs(err, ErrInsufficientLocked)
+	s.Equal(big.NewInt(60), err.(*InsufficientLockedError).Have)
+
+	s.Nil(s.wallet.unlock(s.src, big.NewInt(20), "auction"))
+	s.Equal(big.NewInt(60), s.wallet.availableOf(s.src))
+	s.Nil(s.wallet.unlock(s.src, big.NewInt(40), "auction"))
+	s.Equal(big.NewInt(100), s.wallet.availableOf(s.src))
+	s.Empty(s.wallet.locks.list(common.Address{}, s.src))
+}
+
+func (s *EtherWalletSuite) TestLockExceedsBalance() {
+	s.wallet.setBalance(s.src, big.NewInt(100))
+	s.Nil(s.wallet.lock(s.src, big.NewInt(60), "auction"))
+	s.wallet.setBalance(s.src, big.NewInt(50))
+	s.Equal(big.NewInt(0), s.wallet.availableOf(s.src))
+}
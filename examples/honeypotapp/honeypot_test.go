@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/rollmelette/rollmelette"
 	"github.com/stretchr/testify/suite"
 )
@@ -58,11 +59,33 @@ func (s *HoneypotSuite) TestItWithdrawsEther() {
 	s.Len(result.Reports, 1)
 	s.checkBalance(0, result.Reports[0].Payload)
 	s.Len(result.Vouchers, 1)
-	s.Equal(appAddress, result.Vouchers[0].Destination)
 
-	// check voucher
-	expectedVoucherValue := big.NewInt(100)
-	s.Equal(expectedVoucherValue, result.Vouchers[0].Value)
+	// check voucher, which sends the value to the owner
+	s.Equal(owner, result.Vouchers[0].Destination)
+	s.Equal(big.NewInt(100), result.Vouchers[0].Value)
+	s.Empty(result.Vouchers[0].Payload)
+}
+
+func (s *HoneypotSuite) TestItWithdrawsEtherV1() {
+	app := new(HoneypotApplication)
+	app.Owner = owner
+	opts := rollmelette.NewTesterOpts()
+	opts.PortalLayout = rollmelette.PortalLayoutV1
+	s.tester = rollmelette.NewTesterWithOpts(app, opts)
+
+	result := s.tester.DepositEther(owner, big.NewInt(100), nil)
+	s.Nil(result.Err)
+	result = s.tester.Advance(owner, nil)
+	s.Nil(result.Err)
+	s.Len(result.Vouchers, 1)
+
+	// check voucher, which calls the withdrawal function of the application contract
+	s.Equal(appAddress, result.Vouchers[0].Destination)
+	s.Zero(result.Vouchers[0].Value.Sign())
+	selector := crypto.Keccak256([]byte("withdrawEther(address,uint256)"))[:4]
+	expectedPayload := append(selector, common.LeftPadBytes(owner[:], 32)...)
+	expectedPayload = append(expectedPayload, common.LeftPadBytes(big.NewInt(100).Bytes(), 32)...)
+	s.Equal(expectedPayload, result.Vouchers[0].Payload)
 }
 
 func (s *HoneypotSuite) TestItFailsToWithdrawWithoutFunds() {
@@ -5,6 +5,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log/slog"
 	"os"
 
@@ -26,19 +27,25 @@ func main() {
 		"panic": &panicapp.PanicApplication{},
 	}
 
-	if len(os.Args) < 2 {
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	opts, err := rollmelette.LoadRunOpts(flags, os.Args[1:])
+	if err != nil {
+		slog.Error("failed to load options", "error", err)
+		os.Exit(1)
+	}
+
+	if flags.NArg() < 1 {
 		slog.Error("missing example name")
 		os.Exit(1)
 	}
 
-	app, ok := examples[os.Args[1]]
+	app, ok := examples[flags.Arg(0)]
 	if !ok {
 		slog.Error("example not found")
 		os.Exit(1)
 	}
 
-	opts := rollmelette.NewRunOpts()
-	err := rollmelette.Run(context.Background(), opts, app)
+	err = rollmelette.Run(context.Background(), opts, app)
 	if err != nil {
 		slog.Error("application exited with error", "error", err)
 		os.Exit(1)
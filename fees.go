@@ -0,0 +1,208 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FeeOperation is a wallet operation that may be charged by the fee policy.
+type FeeOperation string
+
+const (
+	// FeeDeposit charges the portal deposits. The depositor pays the fee.
+	FeeDeposit FeeOperation = "deposit"
+
+	// FeeTransfer charges EtherTransfer and ERC20Transfer. The destination pays the fee out of
+	// the transferred value.
+	FeeTransfer FeeOperation = "transfer"
+
+	// FeeWithdraw charges the Ether and ERC20 withdrawals. The voucher pays out the value minus
+	// the fee.
+	FeeWithdraw FeeOperation = "withdraw"
+)
+
+// maxBasisPoints is the number of basis points of the whole value.
+const maxBasisPoints = 10_000
+
+// FeeRule is the fee charged by an operation of an asset.
+// The fee is the flat value plus the basis points of the value, limited to the value.
+type FeeRule struct {
+	// Asset is the ERC20 token address, or the zero address for Ether.
+	Asset common.Address
+
+	// Operation is the operation charged by the rule.
+	Operation FeeOperation
+
+	// Flat is the fixed part of the fee. It may be nil.
+	Flat *big.Int
+
+	// BasisPoints is the part of the fee proportional to the value, in hundredths of a percent.
+	BasisPoints int64
+}
+
+// FeePolicy charges fees on the wallet operations and credits them to the treasury.
+// The zero value doesn't charge fees.
+type FeePolicy struct {
+	// Treasury is the account that receives the fees. It doesn't pay fees.
+	Treasury common.Address
+
+	// Rules are the fees of each asset and operation.
+	// If several rules match an operation, the first one is used.
+	Rules []FeeRule
+}
+
+// Validate returns an error if there are rules without a treasury, or if a rule has a negative
+// fee or more than 100% in basis points.
+func (p FeePolicy) Validate() error {
+	if len(p.Rules) > 0 && p.Treasury == (common.Address{}) {
+		return fmt.Errorf("%w: missing treasury", ErrInvalidFeePolicy)
+	}
+	for i, rule := range p.Rules {
+		if rule.Flat != nil && rule.Flat.Sign() < 0 {
+			return fmt.Errorf("%w: rule %v has negative flat fee", ErrInvalidFeePolicy, i)
+		}
+		if rule.BasisPoints < 0 || rule.BasisPoints > maxBasisPoints {
+			return fmt.Errorf("%w: rule %v has %v basis points", ErrInvalidFeePolicy, i,
+				rule.BasisPoints)
+		}
+	}
+	return nil
+}
+
+// fee returns the fee of the operation. The treasury doesn't pay fees, so the fee is zero if it
+// is one of the given accounts.
+func (p FeePolicy) fee(
+	op FeeOperation,
+	asset common.Address,
+	value *big.Int,
+	accounts ...common.Address,
+) *big.Int {
+	for _, account := range accounts {
+		if account == p.Treasury {
+			return new(big.Int)
+		}
+	}
+	for _, rule := range p.Rules {
+		if rule.Asset != asset || rule.Operation != op {
+			continue
+		}
+		fee := new(big.Int).Mul(value, big.NewInt(rule.BasisPoints))
+		fee.Quo(fee, big.NewInt(maxBasisPoints))
+		if rule.Flat != nil {
+			fee.Add(fee, rule.Flat)
+		}
+		if fee.Cmp(value) > 0 {
+			fee.Set(value)
+		}
+		return fee
+	}
+	return new(big.Int)
+}
+
+// Fee is a fee collected by the treasury.
+type Fee struct {
+	// Operation is the operation that was charged.
+	Operation FeeOperation
+
+	// Asset is the ERC20 token address, or the zero address for Ether.
+	Asset common.Address
+
+	// Account is the account that paid the fee.
+	Account common.Address
+
+	// Value is the amount credited to the treasury.
+	Value *big.Int
+}
+
+// env functions ///////////////////////////////////////////////////////////////////////////////////
+
+// creditFee credits the fee paid by the account to the treasury.
+func (e *env) creditFee(op FeeOperation, asset common.Address, account common.Address, fee *big.Int) error {
+	treasury := e.assetBalanceOf(asset, e.fees.Treasury)
+	newTreasury := new(big.Int).Add(treasury, fee)
+	if newTreasury.Cmp(MaxUint256) > 0 {
+		return &BalanceOverflowError{Asset: asset, Account: e.fees.Treasury, Balance: treasury, Value: fee}
+	}
+	e.setAssetBalance(asset, e.fees.Treasury, newTreasury)
+	e.collected = append(e.collected, Fee{Operation: op, Asset: asset, Account: account, Value: fee})
+	return nil
+}
+
+// payFee moves the fee from the account to the treasury.
+// It skips the locks, because the fee comes out of the funds the operation just credited.
+func (e *env) payFee(op FeeOperation, asset common.Address, account common.Address, fee *big.Int) error {
+	balance := e.assetBalanceOf(asset, account)
+	if err := e.creditFee(op, asset, account, fee); err != nil {
+		return err
+	}
+	e.setAssetBalance(asset, account, new(big.Int).Sub(balance, fee))
+	return nil
+}
+
+// chargeDeposit charges the deposit fee from the depositor.
+func (e *env) chargeDeposit(deposit Deposit) error {
+	var asset, sender common.Address
+	var value *big.Int
+	switch deposit := deposit.(type) {
+	case *EtherDeposit:
+		sender, value = deposit.Sender, deposit.Value
+	case *ERC20Deposit:
+		asset, sender, value = deposit.Token, deposit.Sender, deposit.Value
+	default:
+		return nil
+	}
+	fee := e.fees.fee(FeeDeposit, asset, value, sender)
+	if fee.Sign() == 0 {
+		return nil
+	}
+	return e.payFee(FeeDeposit, asset, sender, fee)
+}
+
+// transferWithFee calls the transfer function and charges the transfer fee from the destination.
+func (e *env) transferWithFee(t Transfer, transfer func() error) error {
+	fee := e.fees.fee(FeeTransfer, t.Asset, t.Value, t.Src, t.Dst)
+	if fee.Sign() == 0 {
+		return transfer()
+	}
+	srcBalance := new(big.Int).Set(e.assetBalanceOf(t.Asset, t.Src))
+	dstBalance := new(big.Int).Set(e.assetBalanceOf(t.Asset, t.Dst))
+	if err := transfer(); err != nil {
+		return err
+	}
+	if err := e.payFee(FeeTransfer, t.Asset, t.Dst, fee); err != nil {
+		e.setAssetBalance(t.Asset, t.Src, srcBalance)
+		e.setAssetBalance(t.Asset, t.Dst, dstBalance)
+		return err
+	}
+	return nil
+}
+
+// withdrawFee credits the withdrawal fee to the treasury and returns the value paid out.
+// The account balance was already debited by the whole value.
+func (e *env) withdrawFee(asset common.Address, account common.Address, value *big.Int) (*big.Int, error) {
+	fee := e.fees.fee(FeeWithdraw, asset, value, account)
+	if fee.Sign() == 0 {
+		return value, nil
+	}
+	if err := e.creditFee(FeeWithdraw, asset, account, fee); err != nil {
+		return nil, err
+	}
+	return new(big.Int).Sub(value, fee), nil
+}
+
+// saveFees returns a function that restores the account balance before a withdrawal, and the
+// treasury balance and collected fees before its fee.
+func (e *env) saveFees(asset common.Address, account common.Address, balance *big.Int) func() {
+	treasury := new(big.Int).Set(e.assetBalanceOf(asset, e.fees.Treasury))
+	collected := len(e.collected)
+	return func() {
+		e.setAssetBalance(asset, e.fees.Treasury, treasury)
+		e.setAssetBalance(asset, account, balance)
+		e.collected = e.collected[:collected]
+	}
+}
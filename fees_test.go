@@ -0,0 +1,262 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestFeeSuite(t *testing.T) {
+	suite.Run(t, new(FeeSuite))
+}
+
+type FeeSuite struct {
+	suite.Suite
+	advance  func(env Env) error
+	tester   *Tester
+	token    common.Address
+	treasury common.Address
+	alice    common.Address
+	bob      common.Address
+}
+
+func (s *FeeSuite) SetupTest() {
+	s.token = common.HexToAddress("0xbabababababababababababababababababababa")
+	s.treasury = common.HexToAddress("0xcacacacacacacacacacacacacacacacacacacaca")
+	s.alice = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.bob = common.HexToAddress("0xfefefefefefefefefefefefefefefefefefefefe")
+	s.advance = func(env Env) error { return nil }
+	app := &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			if deposit != nil {
+				return nil
+			}
+			return s.advance(env)
+		},
+	}
+	opts := NewTesterOpts()
+	opts.Fees = FeePolicy{
+		Treasury: s.treasury,
+		Rules: []FeeRule{
+			{Asset: common.Address{}, Operation: FeeDeposit, BasisPoints: 100},
+			{Asset: common.Address{}, Operation: FeeWithdraw, Flat: big.NewInt(5), BasisPoints: 50},
+			{Asset: s.token, Operation: FeeTransfer, Flat: big.NewInt(3)},
+			{Asset: s.token, Operation: FeeWithdraw, Flat: big.NewInt(100)},
+		},
+	}
+	s.tester = NewTesterWithOpts(app, opts)
+}
+
+func (s *FeeSuite) TestDeposit() {
+	result := s.tester.DepositEther(s.alice, big.NewInt(1000), nil)
+	s.Nil(result.Err)
+	s.Equal([]Fee{{FeeDeposit, common.Address{}, s.alice, big.NewInt(10)}}, result.Fees)
+	s.Equal(big.NewInt(990), s.tester.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(10), s.tester.env.EtherBalanceOf(s.treasury))
+
+	// there is no rule for ERC20 deposits
+	result = s.tester.DepositERC20(s.token, s.alice, big.NewInt(1000), nil)
+	s.Nil(result.Err)
+	s.Empty(result.Fees)
+	s.Equal(big.NewInt(1000), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+}
+
+func (s *FeeSuite) TestTransfer() {
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(100), nil).Err)
+	s.advance = func(env Env) error {
+		return env.ERC20Transfer(s.token, s.alice, s.bob, big.NewInt(40))
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Equal([]Fee{{FeeTransfer, s.token, s.bob, big.NewInt(3)}}, result.Fees)
+	s.Equal(big.NewInt(60), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+	s.Equal(big.NewInt(37), s.tester.env.ERC20BalanceOf(s.token, s.bob))
+	s.Equal(big.NewInt(3), s.tester.env.ERC20BalanceOf(s.token, s.treasury))
+
+	// the treasury doesn't pay fees
+	s.advance = func(env Env) error {
+		return env.ERC20Transfer(s.token, s.treasury, s.bob, big.NewInt(3))
+	}
+	result = s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Empty(result.Fees)
+	s.Equal(big.NewInt(40), s.tester.env.ERC20BalanceOf(s.token, s.bob))
+}
+
+func (s *FeeSuite) TestWithdraw() {
+	s.Require().Nil(s.tester.DepositEther(s.alice, big.NewInt(1000), nil).Err)
+	s.advance = func(env Env) error {
+		_, err := env.EtherWithdrawTo(s.alice, s.bob, big.NewInt(990))
+		return err
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Equal([]Fee{{FeeWithdraw, common.Address{}, s.alice, big.NewInt(9)}}, result.Fees)
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(s.bob, result.Vouchers[0].Destination)
+	s.Equal(big.NewInt(981), result.Vouchers[0].Value)
+	s.Equal(big.NewInt(0), s.tester.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(19), s.tester.env.EtherBalanceOf(s.treasury))
+}
+
+func (s *FeeSuite) TestFeeLimitedToValue() {
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(50), nil).Err)
+	s.advance = func(env Env) error {
+		_, err := env.ERC20Withdraw(s.token, s.alice, big.NewInt(50))
+		return err
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Equal([]Fee{{FeeWithdraw, s.token, s.alice, big.NewInt(50)}}, result.Fees)
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(encodeERC20Withdraw(s.alice, big.NewInt(0)), result.Vouchers[0].Payload)
+}
+
+func (s *FeeSuite) TestRejectRevertsFees() {
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(100), nil).Err)
+	failure := errors.New("failure")
+	s.advance = func(env Env) error {
+		if err := env.ERC20Transfer(s.token, s.alice, s.bob, big.NewInt(40)); err != nil {
+			return err
+		}
+		return failure
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.ErrorIs(result.Err, failure)
+	s.Empty(result.Fees)
+	s.Equal(big.NewInt(0), s.tester.env.ERC20BalanceOf(s.token, s.treasury))
+}
+
+func (s *FeeSuite) TestFailingVoucher() {
+	s.Require().Nil(s.tester.DepositEther(s.alice, big.NewInt(1000), nil).Err)
+	failure := errors.New("failure")
+	var withdrawErr error
+	s.advance = func(env Env) error {
+		_, withdrawErr = env.EtherWithdraw(s.alice, big.NewInt(500))
+		return nil
+	}
+	s.tester.InjectFault(TestFault{Route: LogRouteVoucher, Err: failure})
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.ErrorIs(withdrawErr, failure)
+	s.Empty(result.Fees)
+	s.Equal(big.NewInt(990), s.tester.env.EtherBalanceOf(s.alice))
+	s.Equal(big.NewInt(10), s.tester.env.EtherBalanceOf(s.treasury))
+}
+
+func (s *FeeSuite) TestBatchTransfer() {
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(100), nil).Err)
+	s.advance = func(env Env) error {
+		return env.BatchTransfer([]Transfer{
+			{Asset: s.token, Src: s.alice, Dst: s.bob, Value: big.NewInt(40)},
+			{Asset: s.token, Src: s.alice, Dst: s.bob, Value: big.NewInt(10)},
+		})
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Equal([]Fee{
+		{FeeTransfer, s.token, s.bob, big.NewInt(3)},
+		{FeeTransfer, s.token, s.bob, big.NewInt(3)},
+	}, result.Fees)
+	s.Equal(big.NewInt(50), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+	s.Equal(big.NewInt(44), s.tester.env.ERC20BalanceOf(s.token, s.bob))
+	s.Equal(big.NewInt(6), s.tester.env.ERC20BalanceOf(s.token, s.treasury))
+}
+
+func (s *FeeSuite) TestBatchTransferRevertsFees() {
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(100), nil).Err)
+	var batchErr error
+	s.advance = func(env Env) error {
+		batchErr = env.BatchTransfer([]Transfer{
+			{Asset: s.token, Src: s.alice, Dst: s.bob, Value: big.NewInt(40)},
+			{Asset: s.token, Src: s.alice, Dst: s.bob, Value: big.NewInt(100)},
+		})
+		return nil
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	var legErr *BatchTransferError
+	s.Require().ErrorAs(batchErr, &legErr)
+	s.Equal(1, legErr.Leg)
+	s.Empty(result.Fees)
+	s.Equal(big.NewInt(100), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+	s.Equal(big.NewInt(0), s.tester.env.ERC20BalanceOf(s.token, s.bob))
+	s.Equal(big.NewInt(0), s.tester.env.ERC20BalanceOf(s.token, s.treasury))
+}
+
+func (s *FeeSuite) TestBatchWithdraw() {
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(500), nil).Err)
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.bob, big.NewInt(500), nil).Err)
+	s.advance = func(env Env) error {
+		_, err := env.BatchWithdraw([]Withdrawal{
+			{Asset: s.token, Account: s.alice, Recipient: s.alice, Value: big.NewInt(300)},
+			{Asset: s.token, Account: s.bob, Recipient: s.alice, Value: big.NewInt(200)},
+		})
+		return err
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	s.Equal([]Fee{
+		{FeeWithdraw, s.token, s.alice, big.NewInt(100)},
+		{FeeWithdraw, s.token, s.bob, big.NewInt(100)},
+	}, result.Fees)
+	// the voucher pays out the values minus the fees
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(encodeERC20Withdraw(s.alice, big.NewInt(300)), result.Vouchers[0].Payload)
+	s.Equal(big.NewInt(200), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+	s.Equal(big.NewInt(300), s.tester.env.ERC20BalanceOf(s.token, s.bob))
+	s.Equal(big.NewInt(200), s.tester.env.ERC20BalanceOf(s.token, s.treasury))
+}
+
+func (s *FeeSuite) TestBatchWithdrawRevertsFees() {
+	s.Require().Nil(s.tester.DepositERC20(s.token, s.alice, big.NewInt(500), nil).Err)
+	var batchErr error
+	s.advance = func(env Env) error {
+		_, batchErr = env.BatchWithdraw([]Withdrawal{
+			{Asset: s.token, Account: s.alice, Recipient: s.alice, Value: big.NewInt(300)},
+			{Asset: s.token, Account: s.bob, Recipient: s.alice, Value: big.NewInt(200)},
+		})
+		return nil
+	}
+	result := s.tester.Advance(s.alice, nil)
+	s.Nil(result.Err)
+	var legErr *BatchTransferError
+	s.Require().ErrorAs(batchErr, &legErr)
+	s.Equal(1, legErr.Leg)
+	s.Empty(result.Fees)
+	s.Empty(result.Vouchers)
+	s.Equal(big.NewInt(500), s.tester.env.ERC20BalanceOf(s.token, s.alice))
+	s.Equal(big.NewInt(0), s.tester.env.ERC20BalanceOf(s.token, s.treasury))
+}
+
+func (s *FeeSuite) TestValidate() {
+	s.Nil(FeePolicy{}.Validate())
+	policy := FeePolicy{
+		Treasury: s.treasury,
+		Rules:    []FeeRule{{Operation: FeeDeposit, BasisPoints: 10_001}},
+	}
+	s.ErrorIs(policy.Validate(), ErrInvalidFeePolicy)
+	policy = FeePolicy{
+		Treasury: s.treasury,
+		Rules:    []FeeRule{{Operation: FeeDeposit, Flat: big.NewInt(-1)}},
+	}
+	s.ErrorIs(policy.Validate(), ErrInvalidFeePolicy)
+	policy = FeePolicy{Rules: []FeeRule{{Operation: FeeDeposit, Flat: big.NewInt(1)}}}
+	s.ErrorIs(policy.Validate(), ErrInvalidFeePolicy)
+	policy.Treasury = s.treasury
+	s.Nil(policy.Validate())
+}
+
+func (s *FeeSuite) TestTesterWithoutTreasury() {
+	opts := NewTesterOpts()
+	opts.Fees = FeePolicy{Rules: []FeeRule{{Operation: FeeDeposit, Flat: big.NewInt(1)}}}
+	s.PanicsWithError("invalid fee policy: missing treasury", func() {
+		NewTesterWithOpts(new(testApplication), opts)
+	})
+}
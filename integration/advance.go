@@ -5,35 +5,204 @@ package integration
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"fmt"
-	"os/exec"
+	"log"
+	"math/big"
+	"strings"
+	"time"
 
-	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/rollmelette/rollmelette"
+	"github.com/rollmelette/rollmelette/client"
 )
 
 const ApplicationAddress = "0xab7528bb862fb57e8a2bcd567a2e929a0be56a5e"
 const SenderAddress = "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
 const TestMnemonic = "test test test test test test test test test test test junk"
 
+// receiptPollInterval is the interval between the requests for the transaction receipt.
+const receiptPollInterval = 100 * time.Millisecond
+
+// Sender signs and sends the inputs to the devnet contracts.
+type Sender struct {
+	eth     *ethclient.Client
+	key     *ecdsa.PrivateKey
+	from    common.Address
+	chainId *big.Int
+	client  *client.Client
+}
+
+// NewSender connects to the JSON-RPC endpoint and derives the first account of TestMnemonic.
+func NewSender(ctx context.Context, url string) (*Sender, error) {
+	key, err := DeriveKey(TestMnemonic, DerivationPath)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	eth, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	chainId, err := eth.ChainID(ctx)
+	if err != nil {
+		eth.Close()
+		return nil, fmt.Errorf("get chain id: %w", err)
+	}
+	return &Sender{
+		eth:     eth,
+		key:     key,
+		from:    crypto.PubkeyToAddress(key.PublicKey),
+		chainId: chainId,
+		client:  client.NewClient(rollmelette.NewAddressBook(), common.HexToAddress(ApplicationAddress)),
+	}, nil
+}
+
+// Close closes the connection.
+func (s *Sender) Close() {
+	s.eth.Close()
+}
+
+// Advance sends an input to the input box.
+func (s *Sender) Advance(ctx context.Context, payload []byte) error {
+	return s.send(ctx, s.client.AddInput(payload))
+}
+
+// DepositEther deposits Ether in the application through the Ether portal.
+func (s *Sender) DepositEther(ctx context.Context, value *big.Int, payload []byte) error {
+	tx, err := s.client.DepositEther(value, payload)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, tx)
+}
+
+// DepositERC20 approves the ERC20 portal and deposits the tokens in the application.
+func (s *Sender) DepositERC20(
+	ctx context.Context,
+	token common.Address,
+	value *big.Int,
+	payload []byte,
+) error {
+	tx, err := s.client.DepositERC20(token, value, payload)
+	if err != nil {
+		return err
+	}
+	approve := client.Tx{
+		To:    token,
+		Value: big.NewInt(0),
+		Data:  encodeApprove(tx.To, value),
+	}
+	if err := s.send(ctx, approve); err != nil {
+		return fmt.Errorf("approve: %w", err)
+	}
+	return s.send(ctx, tx)
+}
+
+// send signs and sends the transaction, and waits for the receipt.
+func (s *Sender) send(ctx context.Context, tx client.Tx) error {
+	nonce, err := s.eth.PendingNonceAt(ctx, s.from)
+	if err != nil {
+		return fmt.Errorf("get nonce: %w", err)
+	}
+	tipCap, err := s.eth.SuggestGasTipCap(ctx)
+	if err != nil {
+		return fmt.Errorf("suggest gas tip cap: %w", err)
+	}
+	head, err := s.eth.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("get header: %w", err)
+	}
+	feeCap := new(big.Int).Add(tipCap, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+	gas, err := s.eth.EstimateGas(ctx, ethereum.CallMsg{
+		From:  s.from,
+		To:    &tx.To,
+		Value: tx.Value,
+		Data:  tx.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("estimate gas: %w", err)
+	}
+	signed, err := types.SignNewTx(s.key, types.LatestSignerForChainID(s.chainId), &types.DynamicFeeTx{
+		ChainID:   s.chainId,
+		Nonce:     nonce,
+		GasTipCap: tipCap,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        &tx.To,
+		Value:     tx.Value,
+		Data:      tx.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	if err := s.eth.SendTransaction(ctx, signed); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	receipt, err := s.waitReceipt(ctx, signed.Hash())
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("transaction %v reverted", signed.Hash())
+	}
+	return nil
+}
+
+// waitReceipt polls the receipt of the transaction until it is mined.
+func (s *Sender) waitReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+	for {
+		receipt, err := s.eth.TransactionReceipt(ctx, hash)
+		if err == nil {
+			return receipt, nil
+		}
+		if err != ethereum.NotFound {
+			return nil, fmt.Errorf("get receipt: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 // Advance sends an input using the devnet contract addresses.
 func Advance(ctx context.Context, url string, payload []byte) error {
 	if len(payload) == 0 {
 		return fmt.Errorf("cannot send empty payload")
 	}
-	book := rollmelette.NewAddressBook()
-	input := hexutil.Encode(payload)
-	cmd := exec.CommandContext(ctx,
-		"cast", "send",
-		"--mnemonic", TestMnemonic,
-		"--rpc-url", url,
-		book.InputBox.String(),             // TO
-		"addInput(address,bytes)(bytes32)", // SIG
-		ApplicationAddress, input,          // ARGS
-	)
-	output, err := cmd.CombinedOutput()
+	sender, err := NewSender(ctx, url)
 	if err != nil {
-		return fmt.Errorf("cast: %w: %v", err, string(output))
+		return err
 	}
-	return nil
+	defer sender.Close()
+	return sender.Advance(ctx, payload)
+}
+
+// encodeApprove encodes the call that approves the spender to transfer the tokens.
+func encodeApprove(spender common.Address, value *big.Int) []byte {
+	abiJson := `[{
+		"type": "function",
+		"name": "approve",
+		"inputs": [
+			{"type": "address"},
+			{"type": "uint256"}
+		]
+	}]`
+	abiInterface, err := abi.JSON(strings.NewReader(abiJson))
+	if err != nil {
+		log.Panicf("failed to decode ABI: %v", err)
+	}
+	data, err := abiInterface.Pack("approve", spender, value)
+	if err != nil {
+		log.Panicf("failed to pack: %v", err)
+	}
+	return data
 }
@@ -0,0 +1,140 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rollmelette/rollmelette"
+	"github.com/rollmelette/rollmelette/client"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestSenderSuite(t *testing.T) {
+	suite.Run(t, new(SenderSuite))
+}
+
+type SenderSuite struct {
+	suite.Suite
+	ctx     context.Context
+	cancel  context.CancelFunc
+	server  *httptest.Server
+	sent    []*types.Transaction
+	receipt uint64
+}
+
+func (s *SenderSuite) SetupTest() {
+	s.ctx, s.cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	s.sent = nil
+	s.receipt = types.ReceiptStatusSuccessful
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveRPC))
+}
+
+func (s *SenderSuite) TearDownTest() {
+	s.server.Close()
+	s.cancel()
+}
+
+func (s *SenderSuite) TestDeriveKey() {
+	key, err := DeriveKey(TestMnemonic, DerivationPath)
+	s.Require().Nil(err)
+	s.Equal(common.HexToAddress(SenderAddress), crypto.PubkeyToAddress(key.PublicKey))
+}
+
+func (s *SenderSuite) TestAdvance() {
+	err := Advance(s.ctx, s.server.URL, []byte("hello"))
+	s.Require().Nil(err)
+	s.Require().Len(s.sent, 1)
+
+	tx := s.sent[0]
+	from, err := types.Sender(types.LatestSignerForChainID(big.NewInt(31337)), tx)
+	s.Require().Nil(err)
+	s.Equal(common.HexToAddress(SenderAddress), from)
+
+	c := client.NewClient(rollmelette.NewAddressBook(), common.HexToAddress(ApplicationAddress))
+	msgSender, payload, err := c.Input(from, client.Tx{To: *tx.To(), Value: tx.Value(), Data: tx.Data()})
+	s.Require().Nil(err)
+	s.Equal(from, msgSender)
+	s.Equal([]byte("hello"), payload)
+}
+
+func (s *SenderSuite) TestDepositERC20() {
+	sender, err := NewSender(s.ctx, s.server.URL)
+	s.Require().Nil(err)
+	defer sender.Close()
+
+	book := rollmelette.NewAddressBook()
+	err = sender.DepositERC20(s.ctx, book.TestToken, big.NewInt(100), nil)
+	s.Require().Nil(err)
+	s.Require().Len(s.sent, 2)
+	s.Equal(book.TestToken, *s.sent[0].To())
+	s.Equal(encodeApprove(book.ERC20Portal, big.NewInt(100)), s.sent[0].Data())
+	s.Equal(book.ERC20Portal, *s.sent[1].To())
+}
+
+func (s *SenderSuite) TestReverted() {
+	s.receipt = types.ReceiptStatusFailed
+	err := Advance(s.ctx, s.server.URL, []byte("hello"))
+	s.ErrorContains(err, "reverted")
+}
+
+type rpcRequest struct {
+	Id     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// serveRPC implements the JSON-RPC methods used by the sender.
+func (s *SenderSuite) serveRPC(w http.ResponseWriter, r *http.Request) {
+	var request rpcRequest
+	s.Require().Nil(json.NewDecoder(r.Body).Decode(&request))
+	var result any
+	switch request.Method {
+	case "eth_chainId":
+		result = hexutil.Uint64(31337)
+	case "eth_getTransactionCount":
+		result = hexutil.Uint64(len(s.sent))
+	case "eth_maxPriorityFeePerGas":
+		result = (*hexutil.Big)(big.NewInt(1))
+	case "eth_getBlockByNumber":
+		result = &types.Header{
+			Number:     big.NewInt(1),
+			Difficulty: big.NewInt(0),
+			BaseFee:    big.NewInt(1),
+		}
+	case "eth_estimateGas":
+		result = hexutil.Uint64(100000)
+	case "eth_sendRawTransaction":
+		var raw hexutil.Bytes
+		s.Require().Nil(json.Unmarshal(request.Params[0], &raw))
+		tx := new(types.Transaction)
+		s.Require().Nil(tx.UnmarshalBinary(raw))
+		s.sent = append(s.sent, tx)
+		result = tx.Hash()
+	case "eth_getTransactionReceipt":
+		result = &types.Receipt{
+			Status:      s.receipt,
+			Logs:        []*types.Log{},
+			BlockNumber: big.NewInt(1),
+		}
+	default:
+		s.Failf("unexpected method", "%v", request.Method)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.Require().Nil(json.NewEncoder(w).Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      request.Id,
+		"result":  result,
+	}))
+}
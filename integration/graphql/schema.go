@@ -0,0 +1,13 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+// Package graphql contains the GraphQL schema of the reader API of the Cartesi Rollups Node.
+// The integration package generates its client from this schema with genqlient.
+package graphql
+
+import _ "embed"
+
+// Schema is the source of the reader API schema.
+//
+//go:embed schema.graphql
+var Schema string
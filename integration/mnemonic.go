@@ -0,0 +1,63 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// hardened is the offset of the hardened indices in the derivation path.
+const hardened = 0x80000000
+
+// DerivationPath is the derivation path of the first account, as in Foundry and Hardhat.
+var DerivationPath = []uint32{44 + hardened, 60 + hardened, 0 + hardened, 0, 0}
+
+// DeriveKey derives the private key of the BIP-39 mnemonic with the BIP-32 path.
+func DeriveKey(mnemonic string, path []uint32) (*ecdsa.PrivateKey, error) {
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	seed := pbkdf2.Key([]byte(normalized), []byte("mnemonic"), 2048, 64, sha512.New)
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode := new(big.Int).SetBytes(sum[:32]), sum[32:]
+
+	n := crypto.S256().Params().N
+	for _, index := range path {
+		var data []byte
+		if index >= hardened {
+			data = append([]byte{0}, key.FillBytes(make([]byte, 32))...)
+		} else {
+			private, err := crypto.ToECDSA(key.FillBytes(make([]byte, 32)))
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&private.PublicKey)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(n) >= 0 {
+			return nil, fmt.Errorf("invalid child key at index %v", index)
+		}
+		key = tweak.Add(tweak, key).Mod(tweak, n)
+		if key.Sign() == 0 {
+			return nil, fmt.Errorf("invalid child key at index %v", index)
+		}
+		chainCode = sum[32:]
+	}
+	return crypto.ToECDSA(key.FillBytes(make([]byte, 32)))
+}
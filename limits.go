@@ -0,0 +1,39 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+// OutputLimits limits the outputs of each input, so Rollmelette rejects them before sending them
+// to the Rollup API. The zero value doesn't limit the outputs.
+type OutputLimits struct {
+	// MaxPayloadBytes is the max payload size of each voucher, notice, and report.
+	// If it is zero, the payload size isn't limited.
+	MaxPayloadBytes int
+
+	// MaxOutputs is the max number of vouchers and notices sent by each input.
+	// Reports don't count towards this limit.
+	// If it is zero, the number of outputs isn't limited.
+	MaxOutputs int
+}
+
+// check returns an OutputLimitError if the output of the given route and payload exceeds the
+// limits. The count is the number of outputs sent before by the input, excluding reports.
+func (l OutputLimits) check(route string, count int, payload []byte) error {
+	if l.MaxPayloadBytes > 0 && len(payload) > l.MaxPayloadBytes {
+		return &OutputLimitError{
+			Route: route,
+			Limit: "payload bytes",
+			Value: len(payload),
+			Max:   l.MaxPayloadBytes,
+		}
+	}
+	if route != LogRouteReport && l.MaxOutputs > 0 && count >= l.MaxOutputs {
+		return &OutputLimitError{
+			Route: route,
+			Limit: "outputs",
+			Value: count + 1,
+			Max:   l.MaxOutputs,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestOutputLimitsSuite(t *testing.T) {
+	suite.Run(t, new(OutputLimitsSuite))
+}
+
+type OutputLimitsSuite struct {
+	suite.Suite
+	app    *testApplication
+	tester *Tester
+	sender common.Address
+}
+
+func (s *OutputLimitsSuite) SetupTest() {
+	s.app = new(testApplication)
+	opts := NewTesterOpts()
+	opts.OutputLimits = OutputLimits{MaxPayloadBytes: 4, MaxOutputs: 2}
+	s.tester = NewTesterWithOpts(s.app, opts)
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *OutputLimitsSuite) TestPayloadSize() {
+	var err error
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		_, err = env.TryNotice(payload)
+		return nil
+	}
+	result := s.tester.Advance(s.sender, make([]byte, 4))
+	s.Nil(result.Err)
+	s.Nil(err)
+	s.Len(result.Notices, 1)
+
+	result = s.tester.Advance(s.sender, make([]byte, 5))
+	s.Nil(result.Err)
+	s.ErrorIs(err, ErrOutputLimit)
+	var limitErr *OutputLimitError
+	s.Require().ErrorAs(err, &limitErr)
+	s.Equal(&OutputLimitError{Route: LogRouteNotice, Limit: "payload bytes", Value: 5, Max: 4}, limitErr)
+	s.Empty(result.Notices)
+}
+
+func (s *OutputLimitsSuite) TestOutputCount() {
+	var err error
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Voucher(s.sender, big.NewInt(0), nil)
+		env.Report(nil)
+		env.Report(nil)
+		env.Report(nil)
+		env.Notice(nil)
+		_, err = env.TryDelegateCallVoucher(s.sender, nil)
+		return nil
+	}
+	result := s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.ErrorContains(err, "output limit exceeded: delegate-call-voucher has 3 outputs; max 2")
+	s.Len(result.Reports, 3)
+
+	// the count is reset for each input
+	result = s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Len(result.Notices, 1)
+}
+
+func (s *OutputLimitsSuite) TestPanickingVariant() {
+	s.app.inspect = func(env EnvInspector, payload []byte) error {
+		env.Report(payload)
+		return nil
+	}
+	result := s.tester.Inspect(make([]byte, 5))
+	s.ErrorIs(result.Err, ErrOutputLimit)
+	s.Empty(result.Reports)
+}
+
+func (s *OutputLimitsSuite) TestWithdrawKeepsBalance() {
+	var err error
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Notice(nil)
+		env.Notice(nil)
+		_, err = env.EtherWithdraw(s.sender, big.NewInt(100))
+		return nil
+	}
+	result := s.tester.DepositEther(s.sender, big.NewInt(100), nil)
+	s.Nil(result.Err)
+	s.ErrorIs(err, ErrOutputLimit)
+	s.Empty(result.Vouchers)
+
+	var balance *big.Int
+	s.app.inspect = func(env EnvInspector, payload []byte) error {
+		balance = env.EtherBalanceOf(s.sender)
+		return nil
+	}
+	s.Nil(s.tester.Inspect(nil).Err)
+	s.Equal(big.NewInt(100), balance)
+}
+
+func (s *OutputLimitsSuite) TestRollupMock() {
+	mock := &rollupMock{limits: OutputLimits{MaxPayloadBytes: 1}}
+	_, err := mock.sendNotice(context.Background(), []byte{0, 0})
+	s.ErrorIs(err, ErrOutputLimit)
+	s.Empty(mock.Notices)
+}
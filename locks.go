@@ -0,0 +1,138 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Lock is an amount of an asset that the application locked for a reason.
+// The locked funds stay in the account, but transfers and withdrawals can't use them.
+type Lock struct {
+	Reason string
+	Value  *big.Int
+}
+
+// lockKey identifies the locks of an account for an asset.
+// Asset is the token address, or the zero address for Ether.
+type lockKey struct {
+	asset   common.Address
+	account common.Address
+}
+
+// lockTable keeps the locked funds of the accounts, by reason.
+type lockTable struct {
+	locked map[lockKey]map[string]big.Int
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{
+		locked: make(map[lockKey]map[string]big.Int),
+	}
+}
+
+// total returns the amount locked by the account for every reason.
+func (t *lockTable) total(asset common.Address, account common.Address) *big.Int {
+	total := new(big.Int)
+	for _, value := range t.locked[lockKey{asset, account}] {
+		total.Add(total, &value)
+	}
+	return total
+}
+
+// available returns the part of the balance that isn't locked.
+// The locks may exceed the balance if the application set the balance, so it returns at least
+// zero.
+func (t *lockTable) available(asset common.Address, account common.Address, balance *big.Int) *big.Int {
+	available := new(big.Int).Sub(balance, t.total(asset, account))
+	if available.Sign() <= 0 {
+		return new(big.Int)
+	}
+	return available
+}
+
+// list returns the locks of the account, sorted by reason.
+func (t *lockTable) list(asset common.Address, account common.Address) []Lock {
+	var locks []Lock
+	for reason, value := range t.locked[lockKey{asset, account}] {
+		locks = append(locks, Lock{reason, new(big.Int).Set(&value)})
+	}
+	slices.SortFunc(locks, func(a, b Lock) int {
+		return strings.Compare(a.Reason, b.Reason)
+	})
+	return locks
+}
+
+// lock locks the value if the account has enough available funds.
+func (t *lockTable) lock(
+	asset common.Address,
+	account common.Address,
+	balance *big.Int,
+	reason string,
+	value *big.Int,
+) error {
+	if err := CheckValue(value); err != nil {
+		return err
+	}
+	available := t.available(asset, account, balance)
+	if available.Cmp(value) < 0 {
+		return &InsufficientFundsError{Asset: asset, Account: account, Have: available, Want: value}
+	}
+	key := lockKey{asset, account}
+	if t.locked[key] == nil {
+		t.locked[key] = make(map[string]big.Int)
+	}
+	locked := t.locked[key][reason]
+	t.locked[key][reason] = *new(big.Int).Add(&locked, value)
+	return nil
+}
+
+// unlock unlocks the value if the account has enough funds locked for the reason.
+func (t *lockTable) unlock(asset common.Address, account common.Address, reason string, value *big.Int) error {
+	if err := CheckValue(value); err != nil {
+		return err
+	}
+	key := lockKey{asset, account}
+	locked := t.locked[key][reason]
+	if locked.Cmp(value) < 0 {
+		return &InsufficientLockedError{
+			Asset:   asset,
+			Account: account,
+			Reason:  reason,
+			Have:    new(big.Int).Set(&locked),
+			Want:    value,
+		}
+	}
+	newLocked := new(big.Int).Sub(&locked, value)
+	if newLocked.Sign() == 0 {
+		delete(t.locked[key], reason)
+		if len(t.locked[key]) == 0 {
+			delete(t.locked, key)
+		}
+	} else {
+		t.locked[key][reason] = *newLocked
+	}
+	return nil
+}
+
+// snapshot returns a copy of the locks.
+func (t *lockTable) snapshot() map[lockKey]map[string]big.Int {
+	locked := make(map[lockKey]map[string]big.Int, len(t.locked))
+	for key, reasons := range t.locked {
+		locked[key] = make(map[string]big.Int, len(reasons))
+		for reason, value := range reasons {
+			locked[key][reason] = *new(big.Int).Set(&value)
+		}
+	}
+	return locked
+}
+
+// restore replaces the locks with the snapshot.
+func (t *lockTable) restore(locked map[lockKey]map[string]big.Int) {
+	t.locked = locked
+}
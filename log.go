@@ -0,0 +1,96 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/lmittmann/tint"
+	"github.com/mattn/go-isatty"
+)
+
+// LogFormat is the format of the log messages.
+type LogFormat string
+
+const (
+	// LogFormatTint writes human-readable messages, with colors if the output is a terminal.
+	LogFormatTint LogFormat = "tint"
+
+	// LogFormatText writes messages as key=value pairs.
+	LogFormatText LogFormat = "text"
+
+	// LogFormatJSON writes messages as JSON lines, which is suitable for log shippers.
+	LogFormatJSON LogFormat = "json"
+)
+
+// ParseLogFormat parses the name of a log format.
+func ParseLogFormat(name string) (LogFormat, error) {
+	switch format := LogFormat(name); format {
+	case LogFormatTint, LogFormatText, LogFormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid log format: %v", name)
+	}
+}
+
+// ParseLogLevel parses a log level.
+// The level may be a number, as in slog.Level, or a name, such as "debug" or "warn".
+func ParseLogLevel(s string) (slog.Level, error) {
+	if level, err := strconv.Atoi(s); err == nil {
+		return slog.Level(level), nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level: %v", s)
+	}
+	return level, nil
+}
+
+// defaultLogLevel returns the log level set by the ROLLMELETTE_LOG_LEVEL environment variable.
+// If the variable is not set or invalid, it returns the debug level.
+func defaultLogLevel() slog.Level {
+	if logLevelStr := os.Getenv("ROLLMELETTE_LOG_LEVEL"); logLevelStr != "" {
+		if level, err := ParseLogLevel(logLevelStr); err == nil {
+			return level
+		}
+	}
+	return slog.LevelDebug
+}
+
+// newLogger creates a logger that writes to w with the given level and format.
+func newLogger(w io.Writer, level slog.Level, format LogFormat) *slog.Logger {
+	// disable timestamp because it is irrelevant in the cartesi machine
+	replaceAttr := func(groups []string, attr slog.Attr) slog.Attr {
+		if attr.Key == slog.TimeKey && len(groups) == 0 {
+			var zeroAttr slog.Attr
+			return zeroAttr
+		}
+		return attr
+	}
+	var handler slog.Handler
+	switch format {
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: replaceAttr,
+		})
+	case LogFormatJSON:
+		// keep the timestamp because log shippers rely on it
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
+		})
+	default:
+		file, ok := w.(*os.File)
+		handler = tint.NewHandler(w, &tint.Options{
+			Level:       level,
+			NoColor:     !ok || !isatty.IsTerminal(file.Fd()),
+			ReplaceAttr: replaceAttr,
+		})
+	}
+	return slog.New(handler)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestLogSuite(t *testing.T) {
+	suite.Run(t, new(LogSuite))
+}
+
+type LogSuite struct {
+	suite.Suite
+	buffer bytes.Buffer
+}
+
+func (s *LogSuite) SetupTest() {
+	s.buffer.Reset()
+}
+
+func (s *LogSuite) TestParseLogLevel() {
+	level, err := ParseLogLevel("4")
+	s.Nil(err)
+	s.Equal(slog.LevelWarn, level)
+
+	level, err = ParseLogLevel("info")
+	s.Nil(err)
+	s.Equal(slog.LevelInfo, level)
+
+	_, err = ParseLogLevel("")
+	s.ErrorContains(err, "invalid log level")
+}
+
+func (s *LogSuite) TestJSONLogger() {
+	logger := newLogger(&s.buffer, slog.LevelInfo, LogFormatJSON)
+	logger.Debug("filtered")
+	logger.Info("hello", "key", "value")
+	var line map[string]any
+	s.Require().Nil(json.Unmarshal(s.buffer.Bytes(), &line))
+	s.Equal("hello", line["msg"])
+	s.Equal("value", line["key"])
+	s.Contains(line, "time")
+}
+
+func (s *LogSuite) TestTextLogger() {
+	logger := newLogger(&s.buffer, slog.LevelInfo, LogFormatText)
+	logger.Info("hello", "key", "value")
+	s.Equal("level=INFO msg=hello key=value\n", s.buffer.String())
+}
+
+func (s *LogSuite) TestTesterLogger() {
+	opts := NewTesterOpts()
+	opts.Logger = newLogger(&s.buffer, slog.LevelDebug, LogFormatText)
+	tester := NewTesterWithOpts(new(testApplication), opts)
+	result := tester.Advance(common.Address{}, []byte{0xde, 0xad})
+	s.Nil(result.Err)
+	s.Contains(s.buffer.String(), "msg=\"received advance\"")
+	s.Contains(s.buffer.String(), "payload=0xdead")
+}
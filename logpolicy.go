@@ -0,0 +1,116 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Log routes are the names of the inputs and outputs used by the log policy.
+const (
+	LogRouteAdvance             = "advance"
+	LogRouteInspect             = "inspect"
+	LogRouteVoucher             = "voucher"
+	LogRouteDelegateCallVoucher = "delegate-call-voucher"
+	LogRouteNotice              = "notice"
+	LogRouteReport              = "report"
+)
+
+// LogPolicy controls how Rollmelette logs the payloads of inputs and outputs.
+// The zero value logs every payload in full.
+type LogPolicy struct {
+	// MaxPayloadBytes is the max number of payload bytes in a log message.
+	// Longer payloads are truncated and logged with their size and Keccak-256 hash.
+	// If it is zero, payloads are not truncated.
+	MaxPayloadBytes int
+
+	// RedactSenders contains the senders whose advance payloads are redacted.
+	// The payloads of the outputs emitted while processing their inputs are also redacted.
+	RedactSenders []common.Address
+
+	// RedactRoutes contains the log routes whose payloads are redacted.
+	RedactRoutes []string
+
+	// SampleRates maps the input routes (LogRouteAdvance and LogRouteInspect) to N, so
+	// Rollmelette only logs the payloads of one in every N inputs of that route.
+	// The messages of the other inputs are still logged, without the payloads.
+	// If N is zero or one, Rollmelette logs every payload.
+	SampleRates map[string]int
+}
+
+// inputLog contains the log decisions for the input being processed.
+type inputLog struct {
+	sampled  bool
+	redacted bool
+}
+
+type inputLogKey struct{}
+
+// payloadLogger logs messages with payloads according to the log policy.
+type payloadLogger struct {
+	*slog.Logger
+	policy LogPolicy
+	counts map[string]int
+}
+
+func newPayloadLogger(logger *slog.Logger, policy LogPolicy) *payloadLogger {
+	return &payloadLogger{
+		Logger: logger,
+		policy: policy,
+		counts: make(map[string]int),
+	}
+}
+
+// withInput returns a context with the log decisions for the next input of the given route.
+// The decisions are deterministic because they only depend on the inputs received before.
+func (l *payloadLogger) withInput(ctx context.Context, route string, sender common.Address) context.Context {
+	count := l.counts[route]
+	l.counts[route]++
+	rate := l.policy.SampleRates[route]
+	state := &inputLog{
+		sampled:  rate <= 1 || count%rate == 0,
+		redacted: slices.Contains(l.policy.RedactSenders, sender),
+	}
+	return context.WithValue(ctx, inputLogKey{}, state)
+}
+
+// debug logs a message with the payload of the given route.
+func (l *payloadLogger) debug(ctx context.Context, msg string, route string, payload []byte, args ...any) {
+	if !l.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	state, _ := ctx.Value(inputLogKey{}).(*inputLog)
+	if state != nil && !state.sampled {
+		l.DebugContext(ctx, msg, args...)
+		return
+	}
+	redacted := (state != nil && state.redacted) || slices.Contains(l.policy.RedactRoutes, route)
+	args = append(args, l.payloadArgs(payload, redacted)...)
+	l.DebugContext(ctx, msg, args...)
+}
+
+// payloadArgs returns the log arguments that describe the payload.
+func (l *payloadLogger) payloadArgs(payload []byte, redacted bool) []any {
+	switch {
+	case redacted:
+		return []any{
+			"payload", "[redacted]",
+			"payloadSize", len(payload),
+		}
+	case l.policy.MaxPayloadBytes > 0 && len(payload) > l.policy.MaxPayloadBytes:
+		return []any{
+			"payload", hexutil.Encode(payload[:l.policy.MaxPayloadBytes]) + "...",
+			"payloadSize", len(payload),
+			"payloadHash", crypto.Keccak256Hash(payload),
+		}
+	default:
+		return []any{"payload", hexutil.Encode(payload)}
+	}
+}
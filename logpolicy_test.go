@@ -0,0 +1,121 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestLogPolicySuite(t *testing.T) {
+	suite.Run(t, new(LogPolicySuite))
+}
+
+type LogPolicySuite struct {
+	suite.Suite
+	buffer bytes.Buffer
+	app    *testApplication
+	sender common.Address
+}
+
+func (s *LogPolicySuite) SetupTest() {
+	s.buffer.Reset()
+	s.app = new(testApplication)
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Notice(payload)
+		return nil
+	}
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *LogPolicySuite) newTester(policy LogPolicy) *Tester {
+	opts := NewTesterOpts()
+	opts.Logger = newLogger(&s.buffer, slog.LevelDebug, LogFormatText)
+	opts.LogPolicy = policy
+	return NewTesterWithOpts(s.app, opts)
+}
+
+func (s *LogPolicySuite) lines(msg string) []string {
+	var lines []string
+	for _, line := range strings.Split(s.buffer.String(), "\n") {
+		if strings.Contains(line, "msg=\""+msg+"\"") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func (s *LogPolicySuite) TestFullPayload() {
+	tester := s.newTester(LogPolicy{})
+	tester.Advance(s.sender, []byte{0xde, 0xad, 0xbe, 0xef})
+	s.Contains(s.lines("received advance")[0], "payload=0xdeadbeef")
+	s.Contains(s.lines("sending notice")[0], "payload=0xdeadbeef")
+}
+
+func (s *LogPolicySuite) TestTruncatedPayload() {
+	tester := s.newTester(LogPolicy{MaxPayloadBytes: 2})
+	payload := []byte{0xde, 0xad, 0xbe, 0xef}
+	tester.Advance(s.sender, payload)
+	for _, msg := range []string{"received advance", "sending notice"} {
+		line := s.lines(msg)[0]
+		s.Contains(line, "payload=0xdead...")
+		s.Contains(line, "payloadSize=4")
+		s.Contains(line, "payloadHash="+crypto.Keccak256Hash(payload).String())
+	}
+}
+
+func (s *LogPolicySuite) TestRedactSender() {
+	tester := s.newTester(LogPolicy{RedactSenders: []common.Address{s.sender}})
+	tester.Advance(s.sender, []byte{0xde, 0xad, 0xbe, 0xef})
+	tester.Advance(common.Address{}, []byte{0xfa})
+	advances := s.lines("received advance")
+	s.Contains(advances[0], "payload=[redacted] payloadSize=4")
+	s.Contains(advances[1], "payload=0xfa")
+	notices := s.lines("sending notice")
+	s.Contains(notices[0], "payload=[redacted] payloadSize=4")
+	s.Contains(notices[1], "payload=0xfa")
+}
+
+func (s *LogPolicySuite) TestRedactRoute() {
+	tester := s.newTester(LogPolicy{RedactRoutes: []string{LogRouteNotice}})
+	tester.Advance(s.sender, []byte{0xde, 0xad, 0xbe, 0xef})
+	s.Contains(s.lines("received advance")[0], "payload=0xdeadbeef")
+	s.Contains(s.lines("sending notice")[0], "payload=[redacted]")
+}
+
+func (s *LogPolicySuite) TestSampleRate() {
+	tester := s.newTester(LogPolicy{SampleRates: map[string]int{LogRouteAdvance: 3}})
+	for i := 0; i < 7; i++ {
+		tester.Advance(s.sender, []byte{byte(i)})
+		tester.Inspect(nil)
+	}
+	advances := s.lines("received advance")
+	s.Len(advances, 7)
+	for i, line := range advances {
+		if i%3 == 0 {
+			s.Contains(line, fmt.Sprintf("payload=0x%02x", i))
+		} else {
+			s.NotContains(line, "payload=")
+		}
+	}
+	notices := s.lines("sending notice")
+	s.Len(notices, 7)
+	s.NotContains(notices[1], "payload=")
+	s.Len(s.lines("received inspect"), 7)
+}
+
+func (s *LogPolicySuite) TestWalletLogger() {
+	tester := s.newTester(LogPolicy{})
+	tester.DepositEther(s.sender, MaxUint256, nil)
+	tester.DepositEther(s.sender, big.NewInt(1), nil)
+	s.Len(s.lines("overflow ether balance"), 1)
+}
@@ -0,0 +1,303 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+// InputMetrics contains the execution metrics of an input.
+type InputMetrics struct {
+	// Route is LogRouteAdvance or LogRouteInspect.
+	Route string
+
+	// Index is the advance input index, or the number of inspect inputs received before.
+	Index int
+
+	// Duration is the time spent processing the input.
+	Duration time.Duration
+
+	// AllocatedBytes is the number of heap bytes allocated while processing the input.
+	// It is zero unless the memory measurement is enabled in the options.
+	AllocatedBytes uint64
+
+	// Outputs maps the output routes, such as LogRouteNotice, to the outputs sent by the input.
+	Outputs map[string]OutputMetrics
+
+	// Accepted is true if the input was accepted.
+	Accepted bool
+
+	// Panicked is true if the application panicked while processing the input.
+	Panicked bool
+}
+
+// OutputMetrics contains the metrics of the outputs of a given route.
+type OutputMetrics struct {
+	// Count is the number of outputs.
+	Count int
+
+	// Bytes is the sum of the payload sizes of the outputs.
+	Bytes int
+}
+
+// MetricsSink receives the execution metrics of each input.
+// Rollmelette calls the sink from the goroutine that processes the inputs.
+type MetricsSink interface {
+	// RecordInput receives the metrics of an input after Rollmelette processes it.
+	// The sink may keep the metrics, since Rollmelette doesn't modify them afterwards.
+	RecordInput(metrics InputMetrics)
+}
+
+// inputMeter measures the execution of an input.
+// If memory is true, it also measures the allocated bytes.
+type inputMeter struct {
+	metrics    InputMetrics
+	start      time.Time
+	memory     bool
+	totalAlloc uint64
+}
+
+func newInputMeter(route string, index int, memory bool) *inputMeter {
+	m := &inputMeter{
+		metrics: InputMetrics{
+			Route:   route,
+			Index:   index,
+			Outputs: make(map[string]OutputMetrics),
+		},
+		memory: memory,
+	}
+	if memory {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		m.totalAlloc = memStats.TotalAlloc
+	}
+	m.start = time.Now()
+	return m
+}
+
+// output records an output of the given route.
+func (m *inputMeter) output(route string, payload []byte) {
+	output := m.metrics.Outputs[route]
+	output.Count++
+	output.Bytes += len(payload)
+	m.metrics.Outputs[route] = output
+}
+
+// finish returns the metrics of the input.
+func (m *inputMeter) finish(accepted bool, panicked bool) InputMetrics {
+	m.metrics.Duration = time.Since(m.start)
+	if m.memory {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		m.metrics.AllocatedBytes = memStats.TotalAlloc - m.totalAlloc
+	}
+	m.metrics.Accepted = accepted
+	m.metrics.Panicked = panicked
+	return m.metrics
+}
+
+// MemoryMetrics ///////////////////////////////////////////////////////////////////////////////////
+
+// MemoryMetrics is a metrics sink that stores the metrics in memory.
+type MemoryMetrics struct {
+	mutex  sync.Mutex
+	inputs []InputMetrics
+}
+
+// RecordInput stores the metrics of the input.
+func (m *MemoryMetrics) RecordInput(metrics InputMetrics) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inputs = append(m.inputs, metrics)
+}
+
+// Inputs returns the metrics of the inputs recorded so far.
+func (m *MemoryMetrics) Inputs() []InputMetrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return slices.Clone(m.inputs)
+}
+
+// serveMetrics serves the metrics sink at the address until the returned function is called.
+// If the sink is nil, it creates a PrometheusMetrics sink.
+func serveMetrics(addr string, sink MetricsSink, logger *slog.Logger) (MetricsSink, func(), error) {
+	if sink == nil {
+		sink = NewPrometheusMetrics()
+	}
+	handler, ok := sink.(http.Handler)
+	if !ok {
+		return nil, nil, fmt.Errorf("metrics sink %T doesn't implement http.Handler", sink)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	server := &http.Server{Handler: handler}
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server failed", "error", err)
+		}
+	}()
+	return sink, func() { server.Close() }, nil
+}
+
+// PrometheusMetrics ///////////////////////////////////////////////////////////////////////////////
+
+// prometheusDurationBuckets are the upper bounds of the input duration histogram in seconds.
+var prometheusDurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// PrometheusMetrics is a metrics sink that aggregates the metrics and exports them in the
+// Prometheus text format. It implements http.Handler, so it may be served in host mode.
+type PrometheusMetrics struct {
+	mutex          sync.Mutex
+	inputs         map[[2]string]uint64
+	panics         map[string]uint64
+	allocatedBytes map[string]uint64
+	durationCount  map[string]uint64
+	durationSum    map[string]float64
+	durationBucket map[string][]uint64
+	outputs        map[string]uint64
+	outputBytes    map[string]uint64
+}
+
+// NewPrometheusMetrics creates an empty PrometheusMetrics sink.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		inputs:         make(map[[2]string]uint64),
+		panics:         make(map[string]uint64),
+		allocatedBytes: make(map[string]uint64),
+		durationCount:  make(map[string]uint64),
+		durationSum:    make(map[string]float64),
+		durationBucket: make(map[string][]uint64),
+		outputs:        make(map[string]uint64),
+		outputBytes:    make(map[string]uint64),
+	}
+}
+
+// RecordInput adds the metrics of the input to the aggregated metrics.
+func (p *PrometheusMetrics) RecordInput(metrics InputMetrics) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	status := "rejected"
+	if metrics.Accepted {
+		status = "accepted"
+	}
+	p.inputs[[2]string{metrics.Route, status}]++
+	if metrics.Panicked {
+		p.panics[metrics.Route]++
+	}
+	p.allocatedBytes[metrics.Route] += metrics.AllocatedBytes
+	seconds := metrics.Duration.Seconds()
+	p.durationCount[metrics.Route]++
+	p.durationSum[metrics.Route] += seconds
+	buckets := p.durationBucket[metrics.Route]
+	if buckets == nil {
+		buckets = make([]uint64, len(prometheusDurationBuckets))
+		p.durationBucket[metrics.Route] = buckets
+	}
+	for i, bound := range prometheusDurationBuckets {
+		if seconds <= bound {
+			buckets[i]++
+		}
+	}
+	for route, output := range metrics.Outputs {
+		p.outputs[route] += uint64(output.Count)
+		p.outputBytes[route] += uint64(output.Bytes)
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var b bytes.Buffer
+
+	writeHeader(&b, "rollmelette_inputs_total", "counter", "Number of processed inputs.")
+	for _, key := range sortedKeys(p.inputs, func(k [2]string) string { return k[0] + k[1] }) {
+		fmt.Fprintf(&b, "rollmelette_inputs_total{route=%q,status=%q} %v\n", key[0], key[1], p.inputs[key])
+	}
+
+	writeHeader(&b, "rollmelette_input_panics_total", "counter", "Number of inputs that panicked.")
+	for _, route := range sortedKeys(p.panics, identity) {
+		fmt.Fprintf(&b, "rollmelette_input_panics_total{route=%q} %v\n", route, p.panics[route])
+	}
+
+	writeHeader(&b, "rollmelette_input_allocated_bytes_total", "counter",
+		"Heap bytes allocated while processing inputs.")
+	for _, route := range sortedKeys(p.allocatedBytes, identity) {
+		fmt.Fprintf(&b, "rollmelette_input_allocated_bytes_total{route=%q} %v\n",
+			route, p.allocatedBytes[route])
+	}
+
+	writeHeader(&b, "rollmelette_input_duration_seconds", "histogram",
+		"Time spent processing inputs.")
+	for _, route := range sortedKeys(p.durationCount, identity) {
+		for i, bound := range prometheusDurationBuckets {
+			fmt.Fprintf(&b, "rollmelette_input_duration_seconds_bucket{route=%q,le=\"%v\"} %v\n",
+				route, bound, p.durationBucket[route][i])
+		}
+		fmt.Fprintf(&b, "rollmelette_input_duration_seconds_bucket{route=%q,le=\"+Inf\"} %v\n",
+			route, p.durationCount[route])
+		fmt.Fprintf(&b, "rollmelette_input_duration_seconds_sum{route=%q} %v\n",
+			route, p.durationSum[route])
+		fmt.Fprintf(&b, "rollmelette_input_duration_seconds_count{route=%q} %v\n",
+			route, p.durationCount[route])
+	}
+
+	writeHeader(&b, "rollmelette_outputs_total", "counter", "Number of sent outputs.")
+	for _, route := range sortedKeys(p.outputs, identity) {
+		fmt.Fprintf(&b, "rollmelette_outputs_total{route=%q} %v\n", route, p.outputs[route])
+	}
+
+	writeHeader(&b, "rollmelette_output_bytes_total", "counter", "Payload bytes of sent outputs.")
+	for _, route := range sortedKeys(p.outputBytes, identity) {
+		fmt.Fprintf(&b, "rollmelette_output_bytes_total{route=%q} %v\n", route, p.outputBytes[route])
+	}
+
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = p.WriteTo(w)
+}
+
+func writeHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, kind)
+}
+
+// sortedKeys returns the keys of the map sorted by the given string function.
+func sortedKeys[K comparable, V any](m map[K]V, str func(K) string) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a K, b K) int {
+		sa, sb := str(a), str(b)
+		switch {
+		case sa < sb:
+			return -1
+		case sa > sb:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return keys
+}
+
+func identity(s string) string {
+	return s
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMetricsSuite(t *testing.T) {
+	suite.Run(t, new(MetricsSuite))
+}
+
+type MetricsSuite struct {
+	suite.Suite
+	app     *testApplication
+	metrics *MemoryMetrics
+	tester  *Tester
+	sender  common.Address
+}
+
+func (s *MetricsSuite) SetupTest() {
+	s.app = new(testApplication)
+	s.metrics = new(MemoryMetrics)
+	opts := NewTesterOpts()
+	opts.Metrics = s.metrics
+	opts.MeasureMemory = true
+	s.tester = NewTesterWithOpts(s.app, opts)
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *MetricsSuite) TestAcceptedAdvance() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Notice(payload)
+		env.Notice(payload)
+		env.Voucher(s.sender, nil, []byte{0xfa})
+		env.Report(make([]byte, 1000))
+		return nil
+	}
+	result := s.tester.Advance(s.sender, []byte{0xde, 0xad})
+	s.Nil(result.Err)
+
+	inputs := s.metrics.Inputs()
+	s.Require().Len(inputs, 1)
+	s.Equal(LogRouteAdvance, inputs[0].Route)
+	s.Equal(0, inputs[0].Index)
+	s.True(inputs[0].Accepted)
+	s.False(inputs[0].Panicked)
+	s.Positive(inputs[0].Duration)
+	s.GreaterOrEqual(inputs[0].AllocatedBytes, uint64(1000))
+	s.Equal(map[string]OutputMetrics{
+		LogRouteNotice:  {Count: 2, Bytes: 4},
+		LogRouteVoucher: {Count: 1, Bytes: 1},
+		LogRouteReport:  {Count: 1, Bytes: 1000},
+	}, inputs[0].Outputs)
+}
+
+func (s *MetricsSuite) TestRejectedInputs() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		return fmt.Errorf("reject")
+	}
+	s.app.inspect = func(env EnvInspector, payload []byte) error {
+		panic("inspect panic")
+	}
+	s.tester.Advance(s.sender, nil)
+	s.tester.Inspect(nil)
+	s.tester.Inspect(nil)
+
+	inputs := s.metrics.Inputs()
+	s.Require().Len(inputs, 3)
+	s.False(inputs[0].Accepted)
+	s.False(inputs[0].Panicked)
+	s.Equal(LogRouteInspect, inputs[1].Route)
+	s.Equal(0, inputs[1].Index)
+	s.False(inputs[1].Accepted)
+	s.True(inputs[1].Panicked)
+	s.Equal(1, inputs[2].Index)
+}
+
+func (s *MetricsSuite) TestMemoryDisabled() {
+	metrics := new(MemoryMetrics)
+	opts := NewTesterOpts()
+	opts.Metrics = metrics
+	tester := NewTesterWithOpts(s.app, opts)
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Report(make([]byte, 1000))
+		return nil
+	}
+	tester.Advance(s.sender, nil)
+
+	inputs := metrics.Inputs()
+	s.Require().Len(inputs, 1)
+	s.Positive(inputs[0].Duration)
+	s.Zero(inputs[0].AllocatedBytes)
+}
+
+func (s *MetricsSuite) TestPrometheusMetrics() {
+	metrics := NewPrometheusMetrics()
+	metrics.RecordInput(InputMetrics{
+		Route:          LogRouteAdvance,
+		Duration:       20 * time.Millisecond,
+		AllocatedBytes: 512,
+		Outputs:        map[string]OutputMetrics{LogRouteNotice: {Count: 2, Bytes: 64}},
+		Accepted:       true,
+	})
+	metrics.RecordInput(InputMetrics{
+		Route:    LogRouteAdvance,
+		Duration: 2 * time.Second,
+		Panicked: true,
+	})
+
+	var buffer bytes.Buffer
+	_, err := metrics.WriteTo(&buffer)
+	s.Require().Nil(err)
+	text := buffer.String()
+	s.Contains(text, "# TYPE rollmelette_inputs_total counter\n")
+	s.Contains(text, `rollmelette_inputs_total{route="advance",status="accepted"} 1`)
+	s.Contains(text, `rollmelette_inputs_total{route="advance",status="rejected"} 1`)
+	s.Contains(text, `rollmelette_input_panics_total{route="advance"} 1`)
+	s.Contains(text, `rollmelette_input_allocated_bytes_total{route="advance"} 512`)
+	s.Contains(text, `rollmelette_input_duration_seconds_bucket{route="advance",le="0.05"} 1`)
+	s.Contains(text, `rollmelette_input_duration_seconds_bucket{route="advance",le="5"} 2`)
+	s.Contains(text, `rollmelette_input_duration_seconds_bucket{route="advance",le="+Inf"} 2`)
+	s.Contains(text, `rollmelette_input_duration_seconds_count{route="advance"} 2`)
+	s.Contains(text, `rollmelette_outputs_total{route="notice"} 2`)
+	s.Contains(text, `rollmelette_output_bytes_total{route="notice"} 64`)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	s.Equal(200, recorder.Code)
+	s.Equal(text, recorder.Body.String())
+}
+
+func (s *MetricsSuite) TestServe() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().Nil(err)
+	addr := listener.Addr().String()
+	s.Require().Nil(listener.Close())
+
+	var body []byte
+	rollup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// read the metrics while Run waits for the next input
+		response, err := http.Get("http://" + addr + "/metrics")
+		if s.Nil(err) {
+			body, _ = io.ReadAll(response.Body)
+			response.Body.Close()
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer rollup.Close()
+
+	opts := NewRunOpts()
+	opts.RollupURL = rollup.URL
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	opts.MetricsAddr = addr
+	err = Run(context.Background(), opts, s.app)
+	s.ErrorContains(err, "invalid status 500")
+	s.Contains(string(body), "# TYPE rollmelette_inputs_total counter")
+
+	// the sink must be served over HTTP
+	opts.Metrics = s.metrics
+	err = Run(context.Background(), opts, s.app)
+	s.ErrorContains(err, "metrics sink *rollmelette.MemoryMetrics doesn't implement http.Handler")
+}
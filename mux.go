@@ -0,0 +1,422 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Mux is an Application that hosts several applications in the same machine.
+// It dispatches each input to the first registered application that matches it.
+//
+// Each application keeps its own state and receives a scoped env that reports its namespace.
+// The applications share the wallets and the outputs of the machine, and a rejected input
+// reverts the wallets of every application.
+//
+// The scoped env keeps the state of each application in its namespace:
+//   - The lock reasons are prefixed with "<namespace>/", and the lock methods only see the locks
+//     of the application.
+//   - The native token symbols are prefixed with "<namespace>/", and the application may only
+//     mint, burn, transfer, and withdraw its own tokens, including in batches; other tokens
+//     return ErrNamespaceViolation.
+//   - The schedule methods only see and cancel the actions scheduled by the application, and
+//     the scheduled actions receive the scoped env of the application.
+type Mux struct {
+	routes   []muxRoute
+	fallback *muxRoute
+}
+
+// muxRoute is an application registered in the mux.
+type muxRoute struct {
+	namespace string
+	app       Application
+
+	// match returns the payload for the application and whether the input matches.
+	// The sender is nil for inspect inputs.
+	match func(sender *common.Address, payload []byte) ([]byte, bool)
+}
+
+// NewMux creates an empty Mux.
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// HandlePrefix registers the application for the inputs whose payload starts with the prefix.
+// The mux removes the prefix before sending the payload to the application.
+func (m *Mux) HandlePrefix(namespace string, prefix []byte, app Application) {
+	prefix = bytes.Clone(prefix)
+	m.handle(namespace, app, func(sender *common.Address, payload []byte) ([]byte, bool) {
+		if !bytes.HasPrefix(payload, prefix) {
+			return nil, false
+		}
+		return payload[len(prefix):], true
+	})
+}
+
+// HandleSelectors registers the application for the inputs whose payload starts with one of
+// the 4-byte ABI selectors.
+// The mux sends the whole payload to the application, so it can decode the ABI call.
+func (m *Mux) HandleSelectors(namespace string, app Application, selectors ...[4]byte) {
+	selectors = append([][4]byte(nil), selectors...)
+	m.handle(namespace, app, func(sender *common.Address, payload []byte) ([]byte, bool) {
+		if len(payload) < 4 {
+			return nil, false
+		}
+		for _, selector := range selectors {
+			if bytes.Equal(payload[:4], selector[:]) {
+				return payload, true
+			}
+		}
+		return nil, false
+	})
+}
+
+// HandleSender registers the application for the advance inputs sent by the address.
+// Inspect inputs don't have a sender, so they never match this route.
+func (m *Mux) HandleSender(namespace string, sender common.Address, app Application) {
+	m.handle(namespace, app, func(msgSender *common.Address, payload []byte) ([]byte, bool) {
+		return payload, msgSender != nil && *msgSender == sender
+	})
+}
+
+// HandleDefault registers the application for the inputs that don't match any other route.
+func (m *Mux) HandleDefault(namespace string, app Application) {
+	checkNamespace(namespace)
+	m.fallback = &muxRoute{
+		namespace: namespace,
+		app:       app,
+		match: func(sender *common.Address, payload []byte) ([]byte, bool) {
+			return payload, true
+		},
+	}
+}
+
+func (m *Mux) handle(
+	namespace string,
+	app Application,
+	match func(sender *common.Address, payload []byte) ([]byte, bool),
+) {
+	if app == nil {
+		panic("nil application")
+	}
+	checkNamespace(namespace)
+	m.routes = append(m.routes, muxRoute{namespace, app, match})
+}
+
+// Advance implements the Application interface.
+// It returns ErrNoRoute if no application matches the input.
+func (m *Mux) Advance(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+	route, payload, err := m.route(&metadata.MsgSender, payload)
+	if err != nil {
+		return err
+	}
+	return route.app.Advance(m.env(env, route.namespace), metadata, deposit, payload)
+}
+
+// Inspect implements the Application interface.
+// It returns ErrNoRoute if no application matches the input.
+func (m *Mux) Inspect(env EnvInspector, payload []byte) error {
+	route, payload, err := m.route(nil, payload)
+	if err != nil {
+		return err
+	}
+	return route.app.Inspect(&muxEnvInspector{env, m.scope(route.namespace)}, payload)
+}
+
+// route returns the first route that matches the input and the payload for its application.
+func (m *Mux) route(sender *common.Address, payload []byte) (*muxRoute, []byte, error) {
+	for i := range m.routes {
+		if appPayload, ok := m.routes[i].match(sender, payload); ok {
+			return &m.routes[i], appPayload, nil
+		}
+	}
+	if m.fallback != nil {
+		return m.fallback, payload, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %v bytes", ErrNoRoute, len(payload))
+}
+
+// env returns the scoped env of the application with the namespace.
+func (m *Mux) env(env Env, namespace string) *muxEnv {
+	return &muxEnv{env, m.scope(namespace)}
+}
+
+func (m *Mux) scope(namespace string) muxScope {
+	return muxScope{m, namespace}
+}
+
+// checkNamespace panics if the namespace contains the separator of the scoped state.
+func checkNamespace(namespace string) {
+	if strings.Contains(namespace, "/") {
+		panic(fmt.Sprintf("invalid namespace: %v", namespace))
+	}
+}
+
+// Namespace returns the namespace of the mux application that received the env.
+// If the env didn't come from a mux, it returns false.
+func Namespace(env EnvInspector) (string, bool) {
+	switch env := env.(type) {
+	case *muxEnv:
+		return env.scope.namespace, true
+	case *muxEnvInspector:
+		return env.scope.namespace, true
+	default:
+		return "", false
+	}
+}
+
+// muxScope ////////////////////////////////////////////////////////////////////////////////////////
+
+// muxScope scopes the state of an application hosted by the mux to its namespace.
+type muxScope struct {
+	mux       *Mux
+	namespace string
+}
+
+// prefix returns the prefix of the lock reasons and native symbols of the namespace.
+func (s muxScope) prefix() string {
+	return s.namespace + "/"
+}
+
+// locks returns the locks of the namespace, without the prefix in the reasons.
+func (s muxScope) locks(locks []Lock) []Lock {
+	var scoped []Lock
+	for _, lock := range locks {
+		if reason, ok := strings.CutPrefix(lock.Reason, s.prefix()); ok {
+			scoped = append(scoped, Lock{reason, lock.Value})
+		}
+	}
+	return scoped
+}
+
+// lockedOf returns the sum of the locks of the namespace.
+func (s muxScope) lockedOf(locks []Lock) *big.Int {
+	locked := new(big.Int)
+	for _, lock := range s.locks(locks) {
+		locked.Add(locked, lock.Value)
+	}
+	return locked
+}
+
+// join returns the namespace of an application nested in the namespace.
+// The nested namespace is empty for the application of the scope itself.
+func (s muxScope) join(nested string) string {
+	if nested == "" {
+		return s.namespace
+	}
+	return s.prefix() + nested
+}
+
+// muxSchedule is implemented by the envs that list the actions scheduled in a namespace.
+// The env keeps the namespace in the scheduler queue, so rejected inputs revert it with the queue.
+type muxSchedule interface {
+	scheduledIn(namespace string) []int
+}
+
+// muxScheduler is implemented by the envs that schedule actions in a namespace.
+type muxScheduler interface {
+	muxSchedule
+	scheduleIn(namespace string, action scheduledAction) int
+	cancelIn(namespace string, id int) bool
+}
+
+// schedule returns the scheduler of the env that hosts the mux.
+func (s muxScope) schedule(env EnvInspector) muxSchedule {
+	schedule, ok := env.(muxSchedule)
+	if !ok {
+		panic(fmt.Sprintf("mux: unsupported env %T", env))
+	}
+	return schedule
+}
+
+// scheduler returns the scheduler of the env that hosts the mux.
+func (s muxScope) scheduler(env Env) muxScheduler {
+	scheduler, ok := env.(muxScheduler)
+	if !ok {
+		panic(fmt.Sprintf("mux: unsupported env %T", env))
+	}
+	return scheduler
+}
+
+// checkNative returns ErrNamespaceViolation if the native token belongs to another namespace.
+// Unknown tokens are left for the env to report.
+func (s muxScope) checkNative(env EnvInspector, token common.Address) error {
+	info, ok := env.NativeToken(token)
+	if ok && !strings.HasPrefix(info.Symbol, s.prefix()) {
+		return fmt.Errorf("%w: %v can't change native token %v", ErrNamespaceViolation, s.namespace,
+			info.Symbol)
+	}
+	return nil
+}
+
+// muxEnvInspector /////////////////////////////////////////////////////////////////////////////////
+
+// muxEnvInspector is the inspect env of an application hosted by the mux.
+type muxEnvInspector struct {
+	EnvInspector
+	scope muxScope
+}
+
+func (e *muxEnvInspector) ScheduledActions() []int {
+	return e.scheduledIn("")
+}
+
+func (e *muxEnvInspector) scheduledIn(namespace string) []int {
+	return e.scope.schedule(e.EnvInspector).scheduledIn(e.scope.join(namespace))
+}
+
+func (e *muxEnvInspector) EtherLockedOf(address common.Address) *big.Int {
+	return e.scope.lockedOf(e.EnvInspector.EtherLocks(address))
+}
+
+func (e *muxEnvInspector) EtherLocks(address common.Address) []Lock {
+	return e.scope.locks(e.EnvInspector.EtherLocks(address))
+}
+
+func (e *muxEnvInspector) ERC20LockedOf(token common.Address, address common.Address) *big.Int {
+	return e.scope.lockedOf(e.EnvInspector.ERC20Locks(token, address))
+}
+
+func (e *muxEnvInspector) ERC20Locks(token common.Address, address common.Address) []Lock {
+	return e.scope.locks(e.EnvInspector.ERC20Locks(token, address))
+}
+
+// muxEnv //////////////////////////////////////////////////////////////////////////////////////////
+
+// muxEnv is the env of an application hosted by the mux.
+type muxEnv struct {
+	Env
+	scope muxScope
+}
+
+func (e *muxEnv) ScheduledActions() []int {
+	return e.scheduledIn("")
+}
+
+func (e *muxEnv) scheduledIn(namespace string) []int {
+	return e.scope.scheduler(e.Env).scheduledIn(e.scope.join(namespace))
+}
+
+func (e *muxEnv) EtherLockedOf(address common.Address) *big.Int {
+	return e.scope.lockedOf(e.Env.EtherLocks(address))
+}
+
+func (e *muxEnv) EtherLocks(address common.Address) []Lock {
+	return e.scope.locks(e.Env.EtherLocks(address))
+}
+
+func (e *muxEnv) ERC20LockedOf(token common.Address, address common.Address) *big.Int {
+	return e.scope.lockedOf(e.Env.ERC20Locks(token, address))
+}
+
+func (e *muxEnv) ERC20Locks(token common.Address, address common.Address) []Lock {
+	return e.scope.locks(e.Env.ERC20Locks(token, address))
+}
+
+func (e *muxEnv) EtherLock(address common.Address, value *big.Int, reason string) error {
+	return e.Env.EtherLock(address, value, e.scope.prefix()+reason)
+}
+
+func (e *muxEnv) EtherUnlock(address common.Address, value *big.Int, reason string) error {
+	return e.Env.EtherUnlock(address, value, e.scope.prefix()+reason)
+}
+
+func (e *muxEnv) ERC20Lock(token common.Address, address common.Address, value *big.Int, reason string) error {
+	return e.Env.ERC20Lock(token, address, value, e.scope.prefix()+reason)
+}
+
+func (e *muxEnv) ERC20Unlock(token common.Address, address common.Address, value *big.Int, reason string) error {
+	return e.Env.ERC20Unlock(token, address, value, e.scope.prefix()+reason)
+}
+
+func (e *muxEnv) NativeCreate(token NativeToken) (common.Address, error) {
+	if token.Symbol != "" {
+		token.Symbol = e.scope.prefix() + token.Symbol
+	}
+	return e.Env.NativeCreate(token)
+}
+
+func (e *muxEnv) NativeMint(token common.Address, address common.Address, value *big.Int) error {
+	if err := e.scope.checkNative(e.Env, token); err != nil {
+		return err
+	}
+	return e.Env.NativeMint(token, address, value)
+}
+
+func (e *muxEnv) NativeBurn(token common.Address, address common.Address, value *big.Int) error {
+	if err := e.scope.checkNative(e.Env, token); err != nil {
+		return err
+	}
+	return e.Env.NativeBurn(token, address, value)
+}
+
+func (e *muxEnv) NativeTransfer(token common.Address, src common.Address, dst common.Address, value *big.Int) error {
+	if err := e.scope.checkNative(e.Env, token); err != nil {
+		return err
+	}
+	return e.Env.NativeTransfer(token, src, dst, value)
+}
+
+func (e *muxEnv) NativeWithdraw(token common.Address, address common.Address, value *big.Int) (int, error) {
+	if err := e.scope.checkNative(e.Env, token); err != nil {
+		return 0, err
+	}
+	return e.Env.NativeWithdraw(token, address, value)
+}
+
+func (e *muxEnv) BatchWithdraw(withdrawals []Withdrawal) ([]int, error) {
+	for i, withdrawal := range withdrawals {
+		if err := e.scope.checkNative(e.Env, withdrawal.Asset); err != nil {
+			return nil, &BatchTransferError{Leg: i, Err: err}
+		}
+	}
+	return e.Env.BatchWithdraw(withdrawals)
+}
+
+func (e *muxEnv) BatchTransfer(transfers []Transfer) error {
+	for i, transfer := range transfers {
+		if err := e.scope.checkNative(e.Env, transfer.Asset); err != nil {
+			return &BatchTransferError{Leg: i, Err: err}
+		}
+	}
+	return e.Env.BatchTransfer(transfers)
+}
+
+func (e *muxEnv) ScheduleAt(timestamp int64, action ScheduledAction) int {
+	return e.scheduleIn("", scheduledAction{timestamp: timestamp, action: action})
+}
+
+func (e *muxEnv) ScheduleAtBlock(blockNumber int64, action ScheduledAction) int {
+	scheduled := scheduledAction{blockNumber: blockNumber, byBlock: true, action: action}
+	return e.scheduleIn("", scheduled)
+}
+
+func (e *muxEnv) scheduleIn(namespace string, action scheduledAction) int {
+	action.action = e.scopeAction(action.action)
+	return e.scope.scheduler(e.Env).scheduleIn(e.scope.join(namespace), action)
+}
+
+// scopeAction returns an action that calls the given one with the scoped env.
+func (e *muxEnv) scopeAction(action ScheduledAction) ScheduledAction {
+	if action == nil {
+		return nil
+	}
+	mux, namespace := e.scope.mux, e.scope.namespace
+	return func(env Env, metadata Metadata) error {
+		return action(mux.env(env, namespace), metadata)
+	}
+}
+
+func (e *muxEnv) CancelScheduled(id int) bool {
+	return e.cancelIn("", id)
+}
+
+func (e *muxEnv) cancelIn(namespace string, id int) bool {
+	return e.scope.scheduler(e.Env).cancelIn(e.scope.join(namespace), id)
+}
@@ -0,0 +1,255 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMuxSuite(t *testing.T) {
+	suite.Run(t, new(MuxSuite))
+}
+
+type MuxSuite struct {
+	suite.Suite
+	mux    *Mux
+	tester *Tester
+	sender common.Address
+	admin  common.Address
+}
+
+func (s *MuxSuite) SetupTest() {
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.admin = common.HexToAddress("0xfefefefefefefefefefefefefefefefefefefefe")
+	s.mux = NewMux()
+	s.tester = NewTester(s.mux)
+}
+
+// reportApp returns an application that reports its namespace and payload.
+func (s *MuxSuite) reportApp() *testApplication {
+	report := func(env EnvInspector, payload []byte) error {
+		namespace, ok := Namespace(env)
+		s.True(ok)
+		env.Report(append([]byte(namespace+":"), payload...))
+		return nil
+	}
+	return &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			return report(env, payload)
+		},
+		inspect: report,
+	}
+}
+
+func (s *MuxSuite) TestPrefix() {
+	s.mux.HandlePrefix("game", []byte{1}, s.reportApp())
+	s.mux.HandlePrefix("market", []byte{2}, s.reportApp())
+
+	result := s.tester.Advance(s.sender, []byte{1, 'a'})
+	s.Nil(result.Err)
+	s.Equal([]byte("game:a"), result.Reports[0].Payload)
+
+	result = s.tester.Advance(s.sender, []byte{2, 'b'})
+	s.Nil(result.Err)
+	s.Equal([]byte("market:b"), result.Reports[0].Payload)
+
+	inspectResult := s.tester.Inspect([]byte{2, 'c'})
+	s.Nil(inspectResult.Err)
+	s.Equal([]byte("market:c"), inspectResult.Reports[0].Payload)
+
+	result = s.tester.Advance(s.sender, []byte{3})
+	s.ErrorIs(result.Err, ErrNoRoute)
+}
+
+func (s *MuxSuite) TestSelectors() {
+	transfer := [4]byte{0xa9, 0x05, 0x9c, 0xbb}
+	approve := [4]byte{0x09, 0x5e, 0xa7, 0xb3}
+	s.mux.HandleSelectors("token", s.reportApp(), transfer, approve)
+	s.mux.HandleDefault("default", s.reportApp())
+
+	result := s.tester.Advance(s.sender, []byte{0x09, 0x5e, 0xa7, 0xb3, 'a'})
+	s.Nil(result.Err)
+	s.Equal([]byte("token:\x09\x5e\xa7\xb3a"), result.Reports[0].Payload)
+
+	result = s.tester.Advance(s.sender, []byte{0x09, 0x5e})
+	s.Nil(result.Err)
+	s.Equal([]byte("default:\x09\x5e"), result.Reports[0].Payload)
+}
+
+func (s *MuxSuite) TestSender() {
+	s.mux.HandleSender("admin", s.admin, s.reportApp())
+	s.mux.HandleDefault("default", s.reportApp())
+
+	result := s.tester.Advance(s.admin, []byte("a"))
+	s.Nil(result.Err)
+	s.Equal([]byte("admin:a"), result.Reports[0].Payload)
+
+	result = s.tester.Advance(s.sender, []byte("b"))
+	s.Nil(result.Err)
+	s.Equal([]byte("default:b"), result.Reports[0].Payload)
+
+	// inspect inputs don't have a sender
+	inspectResult := s.tester.Inspect([]byte("c"))
+	s.Nil(inspectResult.Err)
+	s.Equal([]byte("default:c"), inspectResult.Reports[0].Payload)
+}
+
+func (s *MuxSuite) TestSharedWallets() {
+	var balance *big.Int
+	s.mux.HandlePrefix("game", []byte{1}, &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			return env.EtherTransfer(s.sender, s.admin, big.NewInt(10))
+		},
+	})
+	s.mux.HandlePrefix("market", []byte{2}, &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			balance = env.EtherBalanceOf(s.admin)
+			return nil
+		},
+	})
+
+	result := s.tester.DepositEther(s.sender, big.NewInt(100), []byte{1})
+	s.Nil(result.Err)
+	result = s.tester.Advance(s.sender, []byte{2})
+	s.Nil(result.Err)
+	s.Equal(big.NewInt(10), balance)
+}
+
+func (s *MuxSuite) TestNamespaceOutsideMux() {
+	_, ok := Namespace(s.tester.env)
+	s.False(ok)
+}
+
+func (s *MuxSuite) TestScopedState() {
+	var gold common.Address
+	var action int
+	s.mux.HandlePrefix("market", []byte{1}, &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			var err error
+			gold, err = env.NativeCreate(NativeToken{Name: "Gold", Symbol: "GOLD"})
+			if err != nil {
+				return err
+			}
+			if err := env.NativeMint(gold, s.sender, big.NewInt(10)); err != nil {
+				return err
+			}
+			action = env.ScheduleAt(math.MaxInt64, func(env Env, metadata Metadata) error { return nil })
+			return env.EtherLock(s.sender, big.NewInt(60), "listing")
+		},
+	})
+	s.mux.HandlePrefix("game", []byte{2}, &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			// the game doesn't see the state of the market
+			s.Empty(env.EtherLocks(s.sender))
+			s.Equal(big.NewInt(0), env.EtherLockedOf(s.sender))
+			s.Empty(env.ScheduledActions())
+
+			// and can't change it
+			err := env.EtherUnlock(s.sender, big.NewInt(60), "listing")
+			s.ErrorIs(err, ErrInsufficientLocked)
+			err = env.NativeMint(gold, s.sender, big.NewInt(10))
+			s.ErrorIs(err, ErrNamespaceViolation)
+			err = env.NativeBurn(gold, s.sender, big.NewInt(10))
+			s.ErrorIs(err, ErrNamespaceViolation)
+			err = env.NativeTransfer(gold, s.sender, s.sender, big.NewInt(10))
+			s.ErrorIs(err, ErrNamespaceViolation)
+			_, err = env.NativeWithdraw(gold, s.sender, big.NewInt(10))
+			s.ErrorIs(err, ErrNamespaceViolation)
+			_, err = env.BatchWithdraw([]Withdrawal{
+				{Account: s.sender, Recipient: s.sender, Value: big.NewInt(1)},
+				{Asset: gold, Account: s.sender, Recipient: s.sender, Value: big.NewInt(10)},
+			})
+			var legErr *BatchTransferError
+			s.Require().ErrorAs(err, &legErr)
+			s.Equal(1, legErr.Leg)
+			s.ErrorIs(err, ErrNamespaceViolation)
+			err = env.BatchTransfer([]Transfer{
+				{Asset: gold, Src: s.sender, Dst: s.sender, Value: big.NewInt(10)},
+			})
+			s.ErrorIs(err, ErrNamespaceViolation)
+			s.False(env.CancelScheduled(action))
+
+			// the game has its own locks and tokens
+			s.Nil(env.EtherLock(s.sender, big.NewInt(40), "listing"))
+			s.Equal([]Lock{{"listing", big.NewInt(40)}}, env.EtherLocks(s.sender))
+			token, err := env.NativeCreate(NativeToken{Name: "Gold", Symbol: "GOLD"})
+			s.Nil(err)
+			s.Nil(env.NativeMint(token, s.sender, big.NewInt(10)))
+			return nil
+		},
+	})
+
+	result := s.tester.DepositEther(s.sender, big.NewInt(100), []byte{1})
+	s.Require().Nil(result.Err)
+	result = s.tester.Advance(s.sender, []byte{2})
+	s.Require().Nil(result.Err)
+
+	env := s.tester.env
+	s.Equal(NativeTokenAddress("market/GOLD"), gold)
+	s.Equal([]Lock{{"game/listing", big.NewInt(40)}, {"market/listing", big.NewInt(60)}},
+		env.EtherLocks(s.sender))
+	s.Equal([]int{action}, env.ScheduledActions())
+	s.Equal(big.NewInt(10), env.NativeBalanceOf(NativeTokenAddress("game/GOLD"), s.sender))
+	s.Equal(big.NewInt(10), env.NativeBalanceOf(gold, s.sender))
+	s.Empty(result.Vouchers)
+}
+
+func (s *MuxSuite) TestInvalidNamespace() {
+	s.Panics(func() { s.mux.HandleDefault("game/market", s.reportApp()) })
+}
+
+func (s *MuxSuite) TestRejectedSchedule() {
+	noop := func(env Env, metadata Metadata) error { return nil }
+	s.mux.HandlePrefix("market", []byte{1}, &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			env.ScheduleAt(math.MaxInt64, noop)
+			return errors.New("reject")
+		},
+	})
+	s.mux.HandlePrefix("game", []byte{2}, &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			env.ScheduleAt(math.MaxInt64, noop)
+			return nil
+		},
+	})
+
+	s.NotNil(s.tester.Advance(s.sender, []byte{1}).Err)
+	s.Require().Nil(s.tester.Advance(s.sender, []byte{2}).Err)
+
+	// the rejected input reverts the schedule of the market, so the game reuses the id
+	market, game := s.mux.env(s.tester.env, "market"), s.mux.env(s.tester.env, "game")
+	s.Empty(market.ScheduledActions())
+	s.Equal([]int{0}, game.ScheduledActions())
+	s.False(market.CancelScheduled(0))
+	s.Equal([]int{0}, s.tester.env.ScheduledActions())
+}
+
+func (s *MuxSuite) TestScheduledActionEnv() {
+	var namespace string
+	s.mux.HandlePrefix("game", []byte{1}, &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			env.ScheduleAtBlock(metadata.BlockNumber+1, func(env Env, metadata Metadata) error {
+				namespace, _ = Namespace(env)
+				return env.EtherLock(s.sender, big.NewInt(10), "round")
+			})
+			return nil
+		},
+	})
+	s.mux.HandleDefault("market", s.reportApp())
+
+	s.tester.SetBlock(1, 1000)
+	result := s.tester.DepositEther(s.sender, big.NewInt(100), []byte{1})
+	s.Require().Nil(result.Err)
+	s.tester.SetBlock(2, 1000)
+	result = s.tester.Advance(s.sender, nil)
+	s.Require().Nil(result.Err)
+	s.Equal("game", namespace)
+	s.Equal([]Lock{{"game/round", big.NewInt(10)}}, s.tester.env.EtherLocks(s.sender))
+}
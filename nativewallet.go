@@ -0,0 +1,223 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// NativeToken /////////////////////////////////////////////////////////////////////////////////////
+
+// NativeToken is a fungible token issued by the application.
+type NativeToken struct {
+	// Name is the name of the token, such as "Game Points".
+	Name string
+
+	// Symbol is the symbol of the token, such as "PTS".
+	// It identifies the token in the application.
+	Symbol string
+
+	// Decimals is the number of decimals of the token.
+	Decimals uint8
+
+	// Minter is the base-layer contract that mints the token when it is withdrawn.
+	// If it is the zero address, the token can't be withdrawn.
+	Minter common.Address
+}
+
+// NativeTokenAddress returns the address that identifies the native token with the symbol.
+// The address is derived from the symbol, so it doesn't collide with the ERC20 tokens.
+func NativeTokenAddress(symbol string) common.Address {
+	return common.BytesToAddress(crypto.Keccak256([]byte("rollmelette.native:" + symbol)))
+}
+
+// nativeWallet ////////////////////////////////////////////////////////////////////////////////////
+
+// nativeWallet is a wallet that manages the native tokens.
+// The balances are kept by an ERC20 wallet, because they have the same structure.
+type nativeWallet struct {
+	tokens  map[common.Address]NativeToken
+	supply  map[common.Address]big.Int
+	balance *erc20Wallet
+}
+
+// nativeSnapshot contains the state of the native wallet restored on reject.
+type nativeSnapshot struct {
+	tokens  map[common.Address]NativeToken
+	supply  map[common.Address]big.Int
+	balance map[common.Address]map[common.Address]big.Int
+}
+
+func newNativeWallet() *nativeWallet {
+	return &nativeWallet{
+		tokens:  make(map[common.Address]NativeToken),
+		supply:  make(map[common.Address]big.Int),
+		balance: newErc20Wallet(),
+	}
+}
+
+// create registers the token and returns its address.
+func (w *nativeWallet) create(token NativeToken) (common.Address, error) {
+	if token.Symbol == "" {
+		return common.Address{}, fmt.Errorf("%w: empty symbol", ErrInvalidToken)
+	}
+	address := NativeTokenAddress(token.Symbol)
+	if _, ok := w.tokens[address]; ok {
+		return common.Address{}, fmt.Errorf("%w: %v already exists", ErrInvalidToken, token.Symbol)
+	}
+	w.tokens[address] = token
+	return address, nil
+}
+
+// token returns the token with the address.
+func (w *nativeWallet) token(address common.Address) (NativeToken, error) {
+	token, ok := w.tokens[address]
+	if !ok {
+		return NativeToken{}, fmt.Errorf("%w: %v", ErrUnknownToken, address)
+	}
+	return token, nil
+}
+
+func (w *nativeWallet) list() []NativeToken {
+	var addresses []common.Address
+	for address := range w.tokens {
+		addresses = append(addresses, address)
+	}
+	sortAddresses(addresses)
+	tokens := make([]NativeToken, len(addresses))
+	for i, address := range addresses {
+		tokens[i] = w.tokens[address]
+	}
+	return tokens
+}
+
+func (w *nativeWallet) totalSupply(token common.Address) *big.Int {
+	supply := w.supply[token]
+	return new(big.Int).Set(&supply)
+}
+
+func (w *nativeWallet) setSupply(token common.Address, value *big.Int) {
+	if value.Sign() == 0 {
+		delete(w.supply, token)
+	} else {
+		w.supply[token] = *value
+	}
+}
+
+func (w *nativeWallet) mint(token common.Address, address common.Address, value *big.Int) error {
+	if err := CheckValue(value); err != nil {
+		return err
+	}
+	if _, err := w.token(token); err != nil {
+		return err
+	}
+	supply := w.totalSupply(token)
+	newSupply := new(big.Int).Add(supply, value)
+	if newSupply.Cmp(MaxUint256) > 0 {
+		return &BalanceOverflowError{Asset: token, Account: address, Balance: supply, Value: value}
+	}
+	w.setSupply(token, newSupply)
+	w.balance.setBalance(token, address, new(big.Int).Add(w.balance.balanceOf(token, address), value))
+	return nil
+}
+
+func (w *nativeWallet) burn(token common.Address, address common.Address, value *big.Int) error {
+	if err := CheckValue(value); err != nil {
+		return err
+	}
+	if _, err := w.token(token); err != nil {
+		return err
+	}
+	balance := w.balance.balanceOf(token, address)
+	if balance.Cmp(value) < 0 {
+		return &InsufficientFundsError{Asset: token, Account: address, Have: balance, Want: value}
+	}
+	w.balance.setBalance(token, address, new(big.Int).Sub(balance, value))
+	w.setSupply(token, new(big.Int).Sub(w.totalSupply(token), value))
+	return nil
+}
+
+func (w *nativeWallet) transfer(
+	token common.Address,
+	src common.Address,
+	dst common.Address,
+	value *big.Int,
+) error {
+	if _, err := w.token(token); err != nil {
+		return err
+	}
+	return w.balance.transfer(token, src, dst, value)
+}
+
+// withdraw burns the tokens of the address and returns the minter and the payload of the voucher
+// that mints them to the recipient in the base layer.
+func (w *nativeWallet) withdraw(
+	token common.Address,
+	address common.Address,
+	recipient common.Address,
+	value *big.Int,
+) (common.Address, []byte, error) {
+	info, err := w.token(token)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if info.Minter == (common.Address{}) {
+		return common.Address{}, nil, fmt.Errorf("%w: %v has no minter", ErrInvalidToken, info.Symbol)
+	}
+	if err := w.burn(token, address, value); err != nil {
+		return common.Address{}, nil, err
+	}
+	return info.Minter, encodeNativeWithdraw(recipient, value), nil
+}
+
+// snapshot returns a copy of the tokens, supplies, and balances.
+func (w *nativeWallet) snapshot() nativeSnapshot {
+	supply := make(map[common.Address]big.Int, len(w.supply))
+	for token, value := range w.supply {
+		supply[token] = *new(big.Int).Set(&value)
+	}
+	return nativeSnapshot{
+		tokens:  maps.Clone(w.tokens),
+		supply:  supply,
+		balance: w.balance.snapshot(),
+	}
+}
+
+// restore replaces the state with the snapshot.
+func (w *nativeWallet) restore(snapshot nativeSnapshot) {
+	w.tokens = snapshot.tokens
+	w.supply = snapshot.supply
+	w.balance.restore(snapshot.balance)
+}
+
+// auxiliary functions /////////////////////////////////////////////////////////////////////////////
+
+// encodeNativeWithdraw encodes the voucher that mints the withdrawn tokens in the base layer.
+func encodeNativeWithdraw(address common.Address, value *big.Int) []byte {
+	abiJson := `[{
+		"type": "function",
+		"name": "mint",
+		"inputs": [
+			{"type": "address"},
+			{"type": "uint256"}
+		]
+	}]`
+	abiInterface, err := abi.JSON(strings.NewReader(abiJson))
+	if err != nil {
+		log.Panicf("failed to decode ABI: %v", err)
+	}
+	voucher, err := abiInterface.Pack("mint", address, value)
+	if err != nil {
+		log.Panicf("failed to pack: %v", err)
+	}
+	return voucher
+}
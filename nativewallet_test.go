@@ -0,0 +1,156 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestNativeWalletSuite(t *testing.T) {
+	suite.Run(t, new(NativeWalletSuite))
+}
+
+type NativeWalletSuite struct {
+	suite.Suite
+	wallet *nativeWallet
+	token  common.Address
+	minter common.Address
+	src    common.Address
+	dst    common.Address
+}
+
+func (s *NativeWalletSuite) SetupTest() {
+	s.wallet = newNativeWallet()
+	s.minter = common.HexToAddress("0xbabababababababababababababababababababa")
+	s.src = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.dst = common.HexToAddress("0xfefefefefefefefefefefefefefefefefefefefe")
+	var err error
+	s.token, err = s.wallet.create(NativeToken{"Points", "PTS", 2, s.minter})
+	s.Require().Nil(err)
+}
+
+func (s *NativeWalletSuite) TestCreate() {
+	s.Equal(NativeTokenAddress("PTS"), s.token)
+	s.NotEqual(NativeTokenAddress("LP"), s.token)
+	s.Equal([]NativeToken{{"Points", "PTS", 2, s.minter}}, s.wallet.list())
+
+	_, err := s.wallet.create(NativeToken{Name: "Other Points", Symbol: "PTS"})
+	s.ErrorIs(err, ErrInvalidToken)
+	_, err = s.wallet.create(NativeToken{Name: "No Symbol"})
+	s.ErrorIs(err, ErrInvalidToken)
+}
+
+func (s *NativeWalletSuite) TestMintAndBurn() {
+	s.Nil(s.wallet.mint(s.token, s.src, big.NewInt(100)))
+	s.Nil(s.wallet.mint(s.token, s.dst, big.NewInt(50)))
+	s.Equal(big.NewInt(100), s.wallet.balance.balanceOf(s.token, s.src))
+	s.Equal(big.NewInt(150), s.wallet.totalSupply(s.token))
+
+	s.Nil(s.wallet.burn(s.token, s.src, big.NewInt(30)))
+	s.Equal(big.NewInt(70), s.wallet.balance.balanceOf(s.token, s.src))
+	s.Equal(big.NewInt(120), s.wallet.totalSupply(s.token))
+
+	err := s.wallet.burn(s.token, s.src, big.NewInt(71))
+	s.ErrorIs(err, ErrInsufficientFunds)
+}
+
+func (s *NativeWalletSuite) TestMintOverflow() {
+	s.Nil(s.wallet.mint(s.token, s.src, MaxUint256))
+	err := s.wallet.mint(s.token, s.dst, big.NewInt(1))
+	s.ErrorIs(err, ErrBalanceOverflow)
+	s.Equal(MaxUint256, s.wallet.totalSupply(s.token))
+}
+
+func (s *NativeWalletSuite) TestUnknownToken() {
+	unknown := NativeTokenAddress("LP")
+	s.ErrorIs(s.wallet.mint(unknown, s.src, big.NewInt(1)), ErrUnknownToken)
+	s.ErrorIs(s.wallet.burn(unknown, s.src, big.NewInt(1)), ErrUnknownToken)
+	s.ErrorIs(s.wallet.transfer(unknown, s.src, s.dst, big.NewInt(1)), ErrUnknownToken)
+}
+
+func (s *NativeWalletSuite) TestTransfer() {
+	s.Nil(s.wallet.mint(s.token, s.src, big.NewInt(100)))
+	s.Nil(s.wallet.transfer(s.token, s.src, s.dst, big.NewInt(40)))
+	s.Equal(big.NewInt(60), s.wallet.balance.balanceOf(s.token, s.src))
+	s.Equal(big.NewInt(40), s.wallet.balance.balanceOf(s.token, s.dst))
+	s.Equal(big.NewInt(100), s.wallet.totalSupply(s.token))
+
+	err := s.wallet.transfer(s.token, s.src, s.dst, big.NewInt(61))
+	s.ErrorIs(err, ErrInsufficientFunds)
+}
+
+func (s *NativeWalletSuite) TestWithdraw() {
+	s.Nil(s.wallet.mint(s.token, s.src, big.NewInt(100)))
+	minter, payload, err := s.wallet.withdraw(s.token, s.src, s.dst, big.NewInt(40))
+	s.Nil(err)
+	s.Equal(s.minter, minter)
+	s.Equal(encodeNativeWithdraw(s.dst, big.NewInt(40)), payload)
+	s.Equal(big.NewInt(60), s.wallet.totalSupply(s.token))
+
+	token, err := s.wallet.create(NativeToken{Name: "Shares", Symbol: "LP"})
+	s.Require().Nil(err)
+	s.Nil(s.wallet.mint(token, s.src, big.NewInt(100)))
+	_, _, err = s.wallet.withdraw(token, s.src, s.src, big.NewInt(1))
+	s.ErrorIs(err, ErrInvalidToken)
+}
+
+func (s *NativeWalletSuite) TestEnvWithdraw() {
+	var token common.Address
+	failure := errors.New("failure")
+	app := &testApplication{
+		advance: func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+			var err error
+			switch string(payload) {
+			case "create":
+				token, err = env.NativeCreate(NativeToken{"Points", "PTS", 2, s.minter})
+				if err != nil {
+					return err
+				}
+				return env.NativeMint(token, s.src, big.NewInt(100))
+			case "reject":
+				if err := env.NativeMint(token, s.src, big.NewInt(100)); err != nil {
+					return err
+				}
+				return failure
+			case "accept":
+				// the application accepts the input after the voucher fails
+				_, err = env.NativeWithdraw(token, s.src, big.NewInt(40))
+				s.ErrorIs(err, failure)
+				return nil
+			default:
+				_, err = env.NativeWithdraw(token, s.src, big.NewInt(40))
+				return err
+			}
+		},
+	}
+	tester := NewTester(app)
+	s.Nil(tester.Advance(s.src, []byte("create")).Err)
+
+	result := tester.Advance(s.src, []byte("reject"))
+	s.ErrorIs(result.Err, failure)
+	s.Equal(big.NewInt(100), tester.env.NativeTotalSupply(token))
+
+	result = tester.Advance(s.src, nil)
+	s.Nil(result.Err)
+	s.Require().Len(result.Vouchers, 1)
+	s.Equal(s.minter, result.Vouchers[0].Destination)
+	s.Equal(encodeNativeWithdraw(s.src, big.NewInt(40)), result.Vouchers[0].Payload)
+	s.Equal(big.NewInt(60), tester.env.NativeBalanceOf(token, s.src))
+
+	tester.InjectFault(TestFault{Route: LogRouteVoucher, Err: failure})
+	result = tester.Advance(s.src, nil)
+	s.ErrorIs(result.Err, failure)
+	s.Equal(big.NewInt(60), tester.env.NativeBalanceOf(token, s.src))
+
+	tester.InjectFault(TestFault{Route: LogRouteVoucher, Err: failure})
+	result = tester.Advance(s.src, []byte("accept"))
+	s.Nil(result.Err)
+	s.Equal(big.NewInt(60), tester.env.NativeBalanceOf(token, s.src))
+	s.Equal(big.NewInt(60), tester.env.NativeTotalSupply(token))
+}
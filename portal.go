@@ -0,0 +1,169 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PortalLayout is the layout of the payload the portal contracts send to the application.
+// Each release of the rollups contracts may use a different layout.
+type PortalLayout int
+
+const (
+	// PortalLayoutV2 is the layout of the rollups contracts v2.
+	// The portals pack the deposit fields and append the execution-layer data.
+	PortalLayoutV2 PortalLayout = iota
+
+	// PortalLayoutV1 is the layout of the rollups contracts v1.
+	// It is similar to the v2 layout, but the ERC20 portal prepends the success flag of the
+	// token transfer.
+	PortalLayoutV1
+
+	// PortalLayoutLayerData is the layout of portals that pack the deposit fields and append
+	// abi.encode(bytes baseLayerData, bytes execLayerData).
+	// Rollmelette discards the base-layer data and passes the execution-layer data to the
+	// application.
+	PortalLayoutLayerData
+)
+
+func (l PortalLayout) String() string {
+	switch l {
+	case PortalLayoutV2:
+		return "v2"
+	case PortalLayoutV1:
+		return "v1"
+	case PortalLayoutLayerData:
+		return "layer-data"
+	default:
+		return fmt.Sprintf("PortalLayout(%d)", int(l))
+	}
+}
+
+// ParsePortalLayout parses the name of a portal layout, as returned by PortalLayout.String.
+func ParsePortalLayout(name string) (PortalLayout, error) {
+	for _, layout := range []PortalLayout{PortalLayoutV2, PortalLayoutV1, PortalLayoutLayerData} {
+		if layout.String() == name {
+			return layout, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid portal layout: %v", name)
+}
+
+// EncodeEtherDeposit encodes the payload the Ether portal sends to the application.
+func (l PortalLayout) EncodeEtherDeposit(sender common.Address, value *big.Int, data []byte) []byte {
+	payload := make([]byte, 0, common.AddressLength+common.HashLength+len(data))
+	payload = append(payload, sender[:]...)
+	payload = append(payload, value.FillBytes(make([]byte, common.HashLength))...)
+	return append(payload, l.encodeData(data)...)
+}
+
+// DecodeEtherDeposit decodes the payload the Ether portal sends to the application.
+// It returns the deposit and the execution-layer data.
+func (l PortalLayout) DecodeEtherDeposit(payload []byte) (*EtherDeposit, []byte, error) {
+	if len(payload) < common.AddressLength+common.HashLength {
+		return nil, nil, fmt.Errorf("invalid eth deposit size; got %v", len(payload))
+	}
+
+	sender := common.BytesToAddress(payload[:common.AddressLength])
+	payload = payload[common.AddressLength:]
+
+	value := new(big.Int).SetBytes(payload[:common.HashLength])
+	payload = payload[common.HashLength:]
+
+	data, err := l.decodeData(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid eth deposit data: %w", err)
+	}
+	return &EtherDeposit{sender, value}, data, nil
+}
+
+// EncodeERC20Deposit encodes the payload the ERC20 portal sends to the application.
+func (l PortalLayout) EncodeERC20Deposit(
+	token common.Address,
+	sender common.Address,
+	value *big.Int,
+	data []byte,
+) []byte {
+	payload := make([]byte, 0, 1+2*common.AddressLength+common.HashLength+len(data))
+	if l == PortalLayoutV1 {
+		payload = append(payload, 1)
+	}
+	payload = append(payload, token[:]...)
+	payload = append(payload, sender[:]...)
+	payload = append(payload, value.FillBytes(make([]byte, common.HashLength))...)
+	return append(payload, l.encodeData(data)...)
+}
+
+// DecodeERC20Deposit decodes the payload the ERC20 portal sends to the application.
+// It returns the deposit and the execution-layer data.
+func (l PortalLayout) DecodeERC20Deposit(payload []byte) (*ERC20Deposit, []byte, error) {
+	size := 2*common.AddressLength + common.HashLength
+	if l == PortalLayoutV1 {
+		size++
+	}
+	if len(payload) < size {
+		return nil, nil, fmt.Errorf("invalid erc20 deposit size; got %v", len(payload))
+	}
+
+	if l == PortalLayoutV1 {
+		if payload[0] != 1 {
+			return nil, nil, fmt.Errorf("erc20 deposit failed")
+		}
+		payload = payload[1:]
+	}
+
+	token := common.BytesToAddress(payload[:common.AddressLength])
+	payload = payload[common.AddressLength:]
+
+	sender := common.BytesToAddress(payload[:common.AddressLength])
+	payload = payload[common.AddressLength:]
+
+	value := new(big.Int).SetBytes(payload[:common.HashLength])
+	payload = payload[common.HashLength:]
+
+	data, err := l.decodeData(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid erc20 deposit data: %w", err)
+	}
+	return &ERC20Deposit{token, sender, value}, data, nil
+}
+
+// encodeData encodes the execution-layer data appended to the deposit fields.
+func (l PortalLayout) encodeData(data []byte) []byte {
+	if l != PortalLayoutLayerData {
+		return data
+	}
+	encoded, err := layerDataArguments().Pack([]byte{}, data)
+	if err != nil {
+		log.Panicf("failed to pack: %v", err)
+	}
+	return encoded
+}
+
+// decodeData decodes the execution-layer data appended to the deposit fields.
+func (l PortalLayout) decodeData(payload []byte) ([]byte, error) {
+	if l != PortalLayoutLayerData {
+		return payload, nil
+	}
+	values, err := layerDataArguments().Unpack(payload)
+	if err != nil {
+		return nil, err
+	}
+	return values[1].([]byte), nil
+}
+
+// layerDataArguments returns the ABI arguments of the base-layer and execution-layer data.
+func layerDataArguments() abi.Arguments {
+	bytesType, err := abi.NewType("bytes", "", nil)
+	if err != nil {
+		log.Panicf("failed to create ABI type: %v", err)
+	}
+	return abi.Arguments{{Type: bytesType}, {Type: bytesType}}
+}
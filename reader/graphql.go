@@ -0,0 +1,212 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// object is a GraphQL object resolved by the executor.
+type object interface {
+	// typeName returns the name of the GraphQL type.
+	typeName() string
+
+	// field resolves the field with the given arguments.
+	// It returns a scalar, an object, a list of objects, or nil.
+	field(name string, args map[string]any) (any, error)
+}
+
+// graphqlRequest is the body of a GraphQL request.
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlError is an error in the GraphQL response.
+type graphqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// graphqlResponse is the body of a GraphQL response.
+type graphqlResponse struct {
+	Data   any            `json:"data"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+// executor executes a GraphQL operation over the root object.
+type executor struct {
+	vars map[string]any
+}
+
+// executeGraphQL parses, validates, and executes the request.
+func executeGraphQL(schema *ast.Schema, root object, request graphqlRequest) graphqlResponse {
+	doc, errs := gqlparser.LoadQuery(schema, request.Query)
+	if errs != nil {
+		response := graphqlResponse{}
+		for _, err := range errs {
+			response.Errors = append(response.Errors, graphqlError{Message: err.Message})
+		}
+		return response
+	}
+	op := doc.Operations.ForName(request.OperationName)
+	if op == nil {
+		return graphqlResponse{Errors: []graphqlError{{Message: "operation not found"}}}
+	}
+	if op.Operation != ast.Query {
+		return graphqlResponse{Errors: []graphqlError{{Message: "only queries are supported"}}}
+	}
+	vars, err := validator.VariableValues(schema, op, request.Variables)
+	if err != nil {
+		return graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}}
+	}
+	x := &executor{vars: vars}
+	data, err := x.selectObject(root, op.SelectionSet, nil)
+	if err != nil {
+		pathErr, ok := err.(*fieldError)
+		if !ok {
+			pathErr = &fieldError{err: err}
+		}
+		return graphqlResponse{Errors: []graphqlError{{Message: pathErr.err.Error(), Path: pathErr.path}}}
+	}
+	return graphqlResponse{Data: data}
+}
+
+// fieldError is an error resolving the field in the path.
+type fieldError struct {
+	path []any
+	err  error
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf("%v: %v", e.path, e.err)
+}
+
+// selectObject resolves the selected fields of the object.
+func (x *executor) selectObject(obj object, set ast.SelectionSet, path []any) (map[string]any, error) {
+	result := make(map[string]any)
+	for _, field := range x.collectFields(set, nil) {
+		key := field.Alias
+		if key == "" {
+			key = field.Name
+		}
+		fieldPath := append(append([]any{}, path...), key)
+		if field.Name == "__typename" {
+			result[key] = obj.typeName()
+			continue
+		}
+		value, err := obj.field(field.Name, field.ArgumentMap(x.vars))
+		if err != nil {
+			if _, ok := err.(*fieldError); !ok {
+				err = &fieldError{path: fieldPath, err: err}
+			}
+			return nil, err
+		}
+		result[key], err = x.selectValue(value, field.SelectionSet, fieldPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// selectValue resolves the selected fields of an object or a list of objects.
+// Scalars are returned as they are.
+func (x *executor) selectValue(value any, set ast.SelectionSet, path []any) (any, error) {
+	switch value := value.(type) {
+	case object:
+		return x.selectObject(value, set, path)
+	case []object:
+		list := make([]any, len(value))
+		for i, item := range value {
+			var err error
+			list[i], err = x.selectObject(item, set, append(append([]any{}, path...), i))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+// collectFields flattens the fragments of the selection set.
+func (x *executor) collectFields(set ast.SelectionSet, fields []*ast.Field) []*ast.Field {
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if x.included(selection.Directives) {
+				fields = append(fields, selection)
+			}
+		case *ast.InlineFragment:
+			if x.included(selection.Directives) {
+				fields = x.collectFields(selection.SelectionSet, fields)
+			}
+		case *ast.FragmentSpread:
+			if x.included(selection.Directives) && selection.Definition != nil {
+				fields = x.collectFields(selection.Definition.SelectionSet, fields)
+			}
+		}
+	}
+	return fields
+}
+
+// included evaluates the skip and include directives.
+func (x *executor) included(directives ast.DirectiveList) bool {
+	if skip := directives.ForName("skip"); skip != nil {
+		if value, _ := skip.Arguments.ForName("if").Value.Value(x.vars); value == true {
+			return false
+		}
+	}
+	if include := directives.ForName("include"); include != nil {
+		if value, _ := include.Arguments.ForName("if").Value.Value(x.vars); value == false {
+			return false
+		}
+	}
+	return true
+}
+
+// serveGraphQL handles the GraphQL HTTP requests.
+func serveGraphQL(w http.ResponseWriter, r *http.Request, schema *ast.Schema, root object) {
+	var request graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		request.Query = r.URL.Query().Get("query")
+		request.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := decodeJSON(bytes.NewBufferString(vars), &request.Variables); err != nil {
+				http.Error(w, fmt.Sprintf("invalid variables: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := decodeJSON(r.Body, &request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	response := executeGraphQL(schema, root, request)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// decodeJSON decodes the JSON numbers as json.Number, so the validator can coerce them.
+func decodeJSON(r io.Reader, v any) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
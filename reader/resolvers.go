@@ -0,0 +1,533 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package reader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/rollmelette/rollmelette"
+)
+
+var (
+	errInputNotFound   = errors.New("input not found")
+	errVoucherNotFound = errors.New("voucher not found")
+	errNoticeNotFound  = errors.New("notice not found")
+	errReportNotFound  = errors.New("report not found")
+)
+
+// state is a snapshot of the inputs and outputs used to resolve a query.
+type state struct {
+	inputs  []Input
+	history rollmelette.TestHistory
+}
+
+// Query ///////////////////////////////////////////////////////////////////////////////////////////
+
+type queryObject struct {
+	st *state
+}
+
+func (q *queryObject) typeName() string {
+	return "Query"
+}
+
+func (q *queryObject) field(name string, args map[string]any) (any, error) {
+	switch name {
+	case "input":
+		index, err := strconv.Atoi(args["id"].(string))
+		if err != nil || index < 0 || index >= len(q.st.inputs) {
+			return nil, errInputNotFound
+		}
+		return &inputObject{q.st, &q.st.inputs[index]}, nil
+	case "voucher":
+		index, err := intArg(args, "outputIndex")
+		if err != nil {
+			return nil, err
+		}
+		for _, voucher := range q.st.history.Vouchers {
+			if voucher.Index == *index {
+				return &voucherObject{q.st, voucher}, nil
+			}
+		}
+		return nil, errVoucherNotFound
+	case "notice":
+		index, err := intArg(args, "outputIndex")
+		if err != nil {
+			return nil, err
+		}
+		for _, notice := range q.st.history.Notices {
+			if notice.Index == *index {
+				return &noticeObject{q.st, notice}, nil
+			}
+		}
+		return nil, errNoticeNotFound
+	case "report":
+		index, err := intArg(args, "reportIndex")
+		if err != nil {
+			return nil, err
+		}
+		if *index < 0 || *index >= len(q.st.history.Reports) {
+			return nil, errReportNotFound
+		}
+		return &reportObject{q.st, *index, q.st.history.Reports[*index]}, nil
+	case "inputs":
+		var nodes []object
+		where, _ := args["where"].(map[string]any)
+		for i := range q.st.inputs {
+			ok, err := matchInput(&q.st.inputs[i], where)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				nodes = append(nodes, &inputObject{q.st, &q.st.inputs[i]})
+			}
+		}
+		return newConnection("Input", nodes, args)
+	case "vouchers":
+		filters, _ := args["filter"].([]any)
+		return q.st.vouchers(func(voucher rollmelette.TestVoucher) bool {
+			return matchVoucher(voucher, filters)
+		}, args)
+	case "notices":
+		return q.st.notices(func(rollmelette.TestNotice) bool { return true }, args)
+	case "reports":
+		return q.st.reports(func(rollmelette.TestReport) bool { return true }, args)
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+func (st *state) vouchers(match func(rollmelette.TestVoucher) bool, args map[string]any) (any, error) {
+	var nodes []object
+	for _, voucher := range st.history.Vouchers {
+		if match(voucher) {
+			nodes = append(nodes, &voucherObject{st, voucher})
+		}
+	}
+	return newConnection("Voucher", nodes, args)
+}
+
+func (st *state) notices(match func(rollmelette.TestNotice) bool, args map[string]any) (any, error) {
+	var nodes []object
+	for _, notice := range st.history.Notices {
+		if match(notice) {
+			nodes = append(nodes, &noticeObject{st, notice})
+		}
+	}
+	return newConnection("Notice", nodes, args)
+}
+
+func (st *state) reports(match func(rollmelette.TestReport) bool, args map[string]any) (any, error) {
+	var nodes []object
+	for i, report := range st.history.Reports {
+		if match(report) {
+			nodes = append(nodes, &reportObject{st, i, report})
+		}
+	}
+	return newConnection("Report", nodes, args)
+}
+
+// Input ///////////////////////////////////////////////////////////////////////////////////////////
+
+type inputObject struct {
+	st    *state
+	input *Input
+}
+
+func (o *inputObject) typeName() string {
+	return "Input"
+}
+
+func (o *inputObject) field(name string, args map[string]any) (any, error) {
+	in := o.input
+	switch name {
+	case "id", "inputBoxIndex":
+		return strconv.Itoa(in.Index), nil
+	case "index":
+		return in.Index, nil
+	case "status":
+		return string(in.Status), nil
+	case "msgSender":
+		return hexutil.Encode(in.MsgSender[:]), nil
+	case "timestamp", "blockTimestamp":
+		return strconv.FormatInt(in.BlockTimestamp, 10), nil
+	case "blockNumber":
+		return strconv.FormatInt(in.BlockNumber, 10), nil
+	case "payload":
+		return hexutil.Encode(in.Payload), nil
+	case "prevRandao":
+		return in.PrevRandao, nil
+	case "espressoTimestamp", "espressoBlockNumber":
+		return nil, nil
+	case "vouchers":
+		return o.st.vouchers(func(voucher rollmelette.TestVoucher) bool {
+			return voucher.InputIndex == in.Index
+		}, args)
+	case "notices":
+		return o.st.notices(func(notice rollmelette.TestNotice) bool {
+			return notice.InputIndex == in.Index
+		}, args)
+	case "reports":
+		return o.st.reports(func(report rollmelette.TestReport) bool {
+			return report.InputIndex == in.Index
+		}, args)
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+// matchInput returns whether the input matches the InputFilter.
+func matchInput(in *Input, where map[string]any) (bool, error) {
+	lower, err := intArg(where, "indexLowerThan")
+	if err != nil {
+		return false, err
+	}
+	if lower != nil && in.Index >= *lower {
+		return false, nil
+	}
+	greater, err := intArg(where, "indexGreaterThan")
+	if err != nil {
+		return false, err
+	}
+	if greater != nil && in.Index <= *greater {
+		return false, nil
+	}
+	if sender, ok := where["msgSender"].(string); ok && common.HexToAddress(sender) != in.MsgSender {
+		return false, nil
+	}
+	if inputType, ok := where["type"].(string); ok && inputType != "inputbox" {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Outputs /////////////////////////////////////////////////////////////////////////////////////////
+
+type voucherObject struct {
+	st      *state
+	voucher rollmelette.TestVoucher
+}
+
+func (o *voucherObject) typeName() string {
+	return "Voucher"
+}
+
+func (o *voucherObject) field(name string, args map[string]any) (any, error) {
+	switch name {
+	case "index":
+		return o.voucher.Index, nil
+	case "input":
+		return o.st.input(o.voucher.InputIndex)
+	case "destination":
+		return hexutil.Encode(o.voucher.Destination[:]), nil
+	case "payload":
+		return hexutil.Encode(o.voucher.Payload), nil
+	case "value":
+		if o.voucher.Value == nil {
+			return "0", nil
+		}
+		return o.voucher.Value.String(), nil
+	case "executed":
+		return false, nil
+	case "proof", "transactionHash":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+// matchVoucher returns whether the voucher matches every ConvenientFilter.
+// The vouchers are never executed, because there is no base layer.
+func matchVoucher(voucher rollmelette.TestVoucher, filters []any) bool {
+	for _, filter := range filters {
+		filter, _ := filter.(map[string]any)
+		if !matchConvenientFilter(voucher, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchConvenientFilter(voucher rollmelette.TestVoucher, filter map[string]any) bool {
+	if filter == nil {
+		return true
+	}
+	if destination, ok := filter["destination"].(map[string]any); ok {
+		if !matchValueFilter(voucher, destination, func(value any) bool {
+			s, _ := value.(string)
+			return common.HexToAddress(s) == voucher.Destination
+		}) {
+			return false
+		}
+	}
+	if executed, ok := filter["executed"].(map[string]any); ok {
+		if !matchValueFilter(voucher, executed, func(value any) bool {
+			return value == false
+		}) {
+			return false
+		}
+	}
+	return matchLogicalFilter(voucher, filter)
+}
+
+// matchValueFilter evaluates the eq, ne, in, and nin operators with the given equality function,
+// and the logical operators of the filter.
+func matchValueFilter(voucher rollmelette.TestVoucher, filter map[string]any, equal func(any) bool) bool {
+	if value, ok := filter["eq"]; ok && value != nil && !equal(value) {
+		return false
+	}
+	if value, ok := filter["ne"]; ok && value != nil && equal(value) {
+		return false
+	}
+	if values, ok := filter["in"].([]any); ok && !anyEqual(values, equal) {
+		return false
+	}
+	if values, ok := filter["nin"].([]any); ok && anyEqual(values, equal) {
+		return false
+	}
+	return matchLogicalFilter(voucher, filter)
+}
+
+// matchLogicalFilter evaluates the and and or operators of the filter.
+func matchLogicalFilter(voucher rollmelette.TestVoucher, filter map[string]any) bool {
+	if filters, ok := filter["and"].([]any); ok {
+		for _, f := range filters {
+			f, _ := f.(map[string]any)
+			if !matchConvenientFilter(voucher, f) {
+				return false
+			}
+		}
+	}
+	if filters, ok := filter["or"].([]any); ok && len(filters) > 0 {
+		for _, f := range filters {
+			f, _ := f.(map[string]any)
+			if matchConvenientFilter(voucher, f) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func anyEqual(values []any, equal func(any) bool) bool {
+	for _, value := range values {
+		if equal(value) {
+			return true
+		}
+	}
+	return false
+}
+
+type noticeObject struct {
+	st     *state
+	notice rollmelette.TestNotice
+}
+
+func (o *noticeObject) typeName() string {
+	return "Notice"
+}
+
+func (o *noticeObject) field(name string, args map[string]any) (any, error) {
+	switch name {
+	case "index":
+		return o.notice.Index, nil
+	case "input":
+		return o.st.input(o.notice.InputIndex)
+	case "payload":
+		return hexutil.Encode(o.notice.Payload), nil
+	case "proof":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+type reportObject struct {
+	st     *state
+	index  int
+	report rollmelette.TestReport
+}
+
+func (o *reportObject) typeName() string {
+	return "Report"
+}
+
+func (o *reportObject) field(name string, args map[string]any) (any, error) {
+	switch name {
+	case "index":
+		return o.index, nil
+	case "input":
+		return o.st.input(o.report.InputIndex)
+	case "payload":
+		return hexutil.Encode(o.report.Payload), nil
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+func (st *state) input(index int) (object, error) {
+	if index < 0 || index >= len(st.inputs) {
+		return nil, errInputNotFound
+	}
+	return &inputObject{st, &st.inputs[index]}, nil
+}
+
+// Pagination //////////////////////////////////////////////////////////////////////////////////////
+
+type connectionObject struct {
+	nodeType string
+	nodes    []object
+	start    int
+	end      int
+}
+
+// newConnection returns the page of nodes selected by the first, last, after, and before
+// arguments. The cursors are the positions of the nodes in the list.
+func newConnection(nodeType string, nodes []object, args map[string]any) (object, error) {
+	start, end := 0, len(nodes)
+	if after, ok := args["after"].(string); ok {
+		cursor, err := strconv.Atoi(after)
+		if err != nil {
+			return nil, fmt.Errorf("invalid after cursor: %v", after)
+		}
+		start = max(start, cursor+1)
+	}
+	if before, ok := args["before"].(string); ok {
+		cursor, err := strconv.Atoi(before)
+		if err != nil {
+			return nil, fmt.Errorf("invalid before cursor: %v", before)
+		}
+		end = min(end, cursor)
+	}
+	first, err := intArg(args, "first")
+	if err != nil {
+		return nil, err
+	}
+	if first != nil {
+		if *first < 0 {
+			return nil, fmt.Errorf("invalid first: %v", *first)
+		}
+		end = min(end, start+*first)
+	}
+	last, err := intArg(args, "last")
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		if *last < 0 {
+			return nil, fmt.Errorf("invalid last: %v", *last)
+		}
+		start = max(start, end-*last)
+	}
+	start = min(start, len(nodes))
+	end = max(end, start)
+	return &connectionObject{nodeType, nodes, start, end}, nil
+}
+
+func (o *connectionObject) typeName() string {
+	return o.nodeType + "Connection"
+}
+
+func (o *connectionObject) field(name string, args map[string]any) (any, error) {
+	switch name {
+	case "totalCount":
+		return len(o.nodes), nil
+	case "edges":
+		edges := make([]object, 0, o.end-o.start)
+		for i := o.start; i < o.end; i++ {
+			edges = append(edges, &edgeObject{o.nodeType, o.nodes[i], strconv.Itoa(i)})
+		}
+		return edges, nil
+	case "pageInfo":
+		return &pageInfoObject{o}, nil
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+type edgeObject struct {
+	nodeType string
+	node     object
+	cursor   string
+}
+
+func (o *edgeObject) typeName() string {
+	return o.nodeType + "Edge"
+}
+
+func (o *edgeObject) field(name string, args map[string]any) (any, error) {
+	switch name {
+	case "node":
+		return o.node, nil
+	case "cursor":
+		return o.cursor, nil
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+type pageInfoObject struct {
+	connection *connectionObject
+}
+
+func (o *pageInfoObject) typeName() string {
+	return "PageInfo"
+}
+
+func (o *pageInfoObject) field(name string, args map[string]any) (any, error) {
+	c := o.connection
+	switch name {
+	case "startCursor":
+		if c.start == c.end {
+			return nil, nil
+		}
+		return strconv.Itoa(c.start), nil
+	case "endCursor":
+		if c.start == c.end {
+			return nil, nil
+		}
+		return strconv.Itoa(c.end - 1), nil
+	case "hasNextPage":
+		return c.end < len(c.nodes), nil
+	case "hasPreviousPage":
+		return c.start > 0, nil
+	default:
+		return nil, fmt.Errorf("unknown field: %v", name)
+	}
+}
+
+// intArg returns the integer argument, or nil if it isn't set.
+func intArg(args map[string]any, name string) (*int, error) {
+	var value int64
+	switch arg := args[name].(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		value = arg
+	case int:
+		value = int64(arg)
+	case float64:
+		value = int64(arg)
+	case json.Number:
+		var err error
+		value, err = arg.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v: %v", name, arg)
+		}
+	default:
+		return nil, fmt.Errorf("invalid %v: %v", name, arg)
+	}
+	if value > math.MaxInt32 || value < math.MinInt32 {
+		return nil, fmt.Errorf("invalid %v: %v", name, value)
+	}
+	result := int(value)
+	return &result, nil
+}
@@ -0,0 +1,240 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+// Package reader serves the GraphQL reader API of the Cartesi Rollups Node for an application
+// running in the Tester, so frontends can be tested without the node.
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/rollmelette/rollmelette"
+	"github.com/rollmelette/rollmelette/integration/graphql"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Status is the completion status of an input.
+type Status string
+
+const (
+	StatusAccepted Status = "ACCEPTED"
+	StatusRejected Status = "REJECTED"
+)
+
+// Input is an advance input processed by the server.
+type Input struct {
+	rollmelette.Metadata
+	Status  Status
+	Payload []byte
+}
+
+// Server serves the reader API for an application running in the Tester.
+//
+// The server handles the following routes:
+//   - /graphql: the GraphQL reader API, with GET and POST requests.
+//   - /input: adds an advance input, with a JSON body containing the msgSender and the payload.
+//   - /inspect: sends an inspect input, with the payload in the POST body or in the GET path.
+//
+// Like the Tester, the server processes each input as soon as it is added.
+// The outputs don't have proofs and the vouchers are never executed.
+// Delegate call vouchers aren't part of the reader API, so the server doesn't serve them.
+type Server struct {
+	mutex  sync.Mutex
+	tester *rollmelette.Tester
+	inputs []Input
+	schema *ast.Schema
+	mux    *http.ServeMux
+}
+
+// NewServer creates a server for the given application.
+// If opts is nil, this function creates it with the rollmelette.NewTesterOpts function.
+func NewServer(app rollmelette.Application, opts *rollmelette.TesterOpts) *Server {
+	s := &Server{
+		tester: rollmelette.NewTesterWithOpts(app, opts),
+		schema: gqlparser.MustLoadSchema(&ast.Source{Name: "schema.graphql", Input: graphql.Schema}),
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/graphql", s.serveGraphQL)
+	s.mux.HandleFunc("/input", s.serveInput)
+	s.mux.HandleFunc("/inspect", s.serveInspect)
+	s.mux.HandleFunc("/inspect/", s.serveInspect)
+	return s
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Advance sends an advance input to the application.
+func (s *Server) Advance(msgSender common.Address, payload []byte) Input {
+	return s.record(payload, func(t *rollmelette.Tester) rollmelette.TestAdvanceResult {
+		return t.Advance(msgSender, payload)
+	})
+}
+
+// DepositEther sends an advance input from the Ether portal to the application.
+func (s *Server) DepositEther(msgSender common.Address, value *big.Int, payload []byte) Input {
+	portalPayload := s.tester.Book().PortalLayout.EncodeEtherDeposit(msgSender, value, payload)
+	return s.record(portalPayload, func(t *rollmelette.Tester) rollmelette.TestAdvanceResult {
+		return t.DepositEther(msgSender, value, payload)
+	})
+}
+
+// DepositERC20 sends an advance input from the ERC20 portal to the application.
+func (s *Server) DepositERC20(
+	token common.Address,
+	msgSender common.Address,
+	value *big.Int,
+	payload []byte,
+) Input {
+	portalPayload := s.tester.Book().PortalLayout.EncodeERC20Deposit(token, msgSender, value, payload)
+	return s.record(portalPayload, func(t *rollmelette.Tester) rollmelette.TestAdvanceResult {
+		return t.DepositERC20(token, msgSender, value, payload)
+	})
+}
+
+// Inspect sends an inspect input to the application.
+func (s *Server) Inspect(payload []byte) rollmelette.TestInspectResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tester.Inspect(payload)
+}
+
+// Inputs returns the inputs processed by the server.
+func (s *Server) Inputs() []Input {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Input(nil), s.inputs...)
+}
+
+// record sends the advance input and stores it with the given payload.
+func (s *Server) record(
+	payload []byte,
+	advance func(*rollmelette.Tester) rollmelette.TestAdvanceResult,
+) Input {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := advance(s.tester)
+	input := Input{
+		Metadata: result.Metadata,
+		Status:   StatusAccepted,
+		Payload:  payload,
+	}
+	if result.Err != nil {
+		input.Status = StatusRejected
+	}
+	s.inputs = append(s.inputs, input)
+	return input
+}
+
+// snapshot returns the state used to resolve a query.
+func (s *Server) snapshot() *state {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &state{
+		inputs:  append([]Input(nil), s.inputs...),
+		history: s.tester.History(),
+	}
+}
+
+// HTTP handlers //////////////////////////////////////////////////////////////////////////////////
+
+func (s *Server) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	serveGraphQL(w, r, s.schema, &queryObject{s.snapshot()})
+}
+
+type inputRequest struct {
+	MsgSender string `json:"msgSender"`
+	Payload   string `json:"payload"`
+}
+
+type inputResponse struct {
+	Index int `json:"index"`
+}
+
+func (s *Server) serveInput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var request inputRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !common.IsHexAddress(request.MsgSender) {
+		http.Error(w, "invalid msgSender", http.StatusBadRequest)
+		return
+	}
+	payload, err := hexutil.Decode(request.Payload)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	input := s.Advance(common.HexToAddress(request.MsgSender), payload)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(inputResponse{Index: input.Index})
+}
+
+type inspectReport struct {
+	Payload string `json:"payload"`
+}
+
+type inspectResponse struct {
+	Status              string          `json:"status"`
+	ExceptionPayload    *string         `json:"exception_payload"`
+	Reports             []inspectReport `json:"reports"`
+	ProcessedInputCount int             `json:"processed_input_count"`
+}
+
+func (s *Server) serveInspect(w http.ResponseWriter, r *http.Request) {
+	var payload []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		segment := strings.TrimPrefix(strings.TrimPrefix(r.URL.EscapedPath(), "/inspect"), "/")
+		segment, err = url.PathUnescape(segment)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid payload: %v", err), http.StatusBadRequest)
+			return
+		}
+		payload = []byte(segment)
+	case http.MethodPost:
+		payload, err = io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mutex.Lock()
+	result := s.tester.Inspect(payload)
+	count := len(s.inputs)
+	s.mutex.Unlock()
+	response := inspectResponse{
+		Status:              "Accepted",
+		Reports:             []inspectReport{},
+		ProcessedInputCount: count,
+	}
+	if result.Err != nil {
+		response.Status = "Rejected"
+	}
+	for _, report := range result.Reports {
+		response.Reports = append(response.Reports, inspectReport{Payload: hexutil.Encode(report.Payload)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
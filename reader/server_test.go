@@ -0,0 +1,236 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/rollmelette/rollmelette"
+	"github.com/rollmelette/rollmelette/examples/echoapp"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+type ServerSuite struct {
+	suite.Suite
+	server *Server
+	http   *httptest.Server
+	sender common.Address
+}
+
+func (s *ServerSuite) SetupTest() {
+	opts := rollmelette.NewTesterOpts()
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s.server = NewServer(new(echoapp.EchoApplication), opts)
+	s.http = httptest.NewServer(s.server)
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *ServerSuite) TearDownTest() {
+	s.http.Close()
+}
+
+func (s *ServerSuite) TestNodeState() {
+	s.post("/input", `{"msgSender":"0xfafafafafafafafafafafafafafafafafafafafa","payload":"0xdeadbeef"}`)
+	s.server.Advance(s.sender, []byte{0xca, 0xfe})
+
+	data := s.query(`{
+		inputs {
+			totalCount
+			edges {
+				node {
+					index
+					status
+					msgSender
+					payload
+					vouchers { edges { node { index destination payload value executed } } }
+					notices { edges { node { index payload input { index } } } }
+					reports { edges { node { index payload } } }
+				}
+			}
+		}
+	}`, nil)
+	expected := `{
+		"inputs": {
+			"totalCount": 2,
+			"edges": [
+				{"node": {
+					"index": 0,
+					"status": "ACCEPTED",
+					"msgSender": "0xfafafafafafafafafafafafafafafafafafafafa",
+					"payload": "0xdeadbeef",
+					"vouchers": {"edges": [{"node": {"index": 0, "destination": "0xfafafafafafafafafafafafafafafafafafafafa", "payload": "0xdeadbeef", "value": "0", "executed": false}}]},
+					"notices": {"edges": [{"node": {"index": 0, "payload": "0xdeadbeef", "input": {"index": 0}}}]},
+					"reports": {"edges": [{"node": {"index": 0, "payload": "0xdeadbeef"}}]}
+				}},
+				{"node": {
+					"index": 1,
+					"status": "ACCEPTED",
+					"msgSender": "0xfafafafafafafafafafafafafafafafafafafafa",
+					"payload": "0xcafe",
+					"vouchers": {"edges": [{"node": {"index": 1, "destination": "0xfafafafafafafafafafafafafafafafafafafafa", "payload": "0xcafe", "value": "0", "executed": false}}]},
+					"notices": {"edges": [{"node": {"index": 1, "payload": "0xcafe", "input": {"index": 1}}}]},
+					"reports": {"edges": [{"node": {"index": 1, "payload": "0xcafe"}}]}
+				}}
+			]
+		}
+	}`
+	s.JSONEq(expected, data)
+}
+
+func (s *ServerSuite) TestPagination() {
+	for i := 0; i < 5; i++ {
+		s.server.Advance(s.sender, []byte{byte(i)})
+	}
+	query := `query notices($first: Int, $last: Int, $after: String, $before: String) {
+		notices(first: $first, last: $last, after: $after, before: $before) {
+			totalCount
+			edges { cursor node { index } }
+			pageInfo { startCursor endCursor hasNextPage hasPreviousPage }
+		}
+	}`
+
+	data := s.query(query, map[string]any{"first": 2, "after": "0"})
+	s.JSONEq(`{"notices": {
+		"totalCount": 5,
+		"edges": [{"cursor": "1", "node": {"index": 1}}, {"cursor": "2", "node": {"index": 2}}],
+		"pageInfo": {"startCursor": "1", "endCursor": "2", "hasNextPage": true, "hasPreviousPage": true}
+	}}`, data)
+
+	data = s.query(query, map[string]any{"last": 2})
+	s.JSONEq(`{"notices": {
+		"totalCount": 5,
+		"edges": [{"cursor": "3", "node": {"index": 3}}, {"cursor": "4", "node": {"index": 4}}],
+		"pageInfo": {"startCursor": "3", "endCursor": "4", "hasNextPage": false, "hasPreviousPage": true}
+	}}`, data)
+
+	data = s.query(query, map[string]any{"after": "4"})
+	s.JSONEq(`{"notices": {
+		"totalCount": 5,
+		"edges": [],
+		"pageInfo": {"startCursor": null, "endCursor": null, "hasNextPage": false, "hasPreviousPage": true}
+	}}`, data)
+}
+
+func (s *ServerSuite) TestFilters() {
+	other := common.HexToAddress("0xfefefefefefefefefefefefefefefefefefefefe")
+	s.server.Advance(s.sender, []byte{0})
+	s.server.Advance(other, []byte{1})
+	s.server.Advance(s.sender, []byte{2})
+
+	data := s.query(`{
+		inputs(where: {msgSender: "0xfafafafafafafafafafafafafafafafafafafafa", indexGreaterThan: 0}) {
+			edges { node { index } }
+		}
+	}`, nil)
+	s.JSONEq(`{"inputs": {"edges": [{"node": {"index": 2}}]}}`, data)
+
+	data = s.query(`{
+		vouchers(filter: [{destination: {eq: "0xfefefefefefefefefefefefefefefefefefefefe"}}]) {
+			edges { node { index } }
+		}
+	}`, nil)
+	s.JSONEq(`{"vouchers": {"edges": [{"node": {"index": 1}}]}}`, data)
+
+	data = s.query(`{
+		vouchers(filter: [{executed: {eq: true}}]) {
+			totalCount
+		}
+	}`, nil)
+	s.JSONEq(`{"vouchers": {"totalCount": 0}}`, data)
+}
+
+func (s *ServerSuite) TestSingleOutputs() {
+	s.server.Advance(s.sender, []byte{0xca, 0xfe})
+	data := s.query(`{
+		input(id: "0") { status payload }
+		voucher(outputIndex: 0) { payload }
+		notice(outputIndex: 0) { payload }
+		report(reportIndex: 0) { payload input { index } }
+	}`, nil)
+	s.JSONEq(`{
+		"input": {"status": "ACCEPTED", "payload": "0xcafe"},
+		"voucher": {"payload": "0xcafe"},
+		"notice": {"payload": "0xcafe"},
+		"report": {"payload": "0xcafe", "input": {"index": 0}}
+	}`, data)
+}
+
+func (s *ServerSuite) TestErrors() {
+	response := s.graphql(`{ input(id: "1") { status } }`, nil)
+	s.Require().Len(response.Errors, 1)
+	s.Equal("input not found", response.Errors[0].Message)
+	s.Equal([]any{"input"}, response.Errors[0].Path)
+
+	response = s.graphql(`{ inputs { unknown } }`, nil)
+	s.Require().Len(response.Errors, 1)
+	s.Nil(response.Data)
+}
+
+func (s *ServerSuite) TestInspect() {
+	s.server.Advance(s.sender, nil)
+
+	resp, err := http.Post(s.http.URL+"/inspect", "application/octet-stream", bytes.NewBufferString("hello"))
+	s.Require().Nil(err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	s.Require().Nil(err)
+	s.JSONEq(`{
+		"status": "Accepted",
+		"exception_payload": null,
+		"reports": [{"payload": "0x68656c6c6f"}],
+		"processed_input_count": 1
+	}`, string(body))
+}
+
+func (s *ServerSuite) TestInspectPath() {
+	resp, err := http.Get(s.http.URL + "/inspect/hello%20world%2Fagain")
+	s.Require().Nil(err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	s.Require().Nil(err)
+	s.JSONEq(`{
+		"status": "Accepted",
+		"exception_payload": null,
+		"reports": [{"payload": "`+hexutil.Encode([]byte("hello world/again"))+`"}],
+		"processed_input_count": 0
+	}`, string(body))
+}
+
+func (s *ServerSuite) post(route string, body string) {
+	resp, err := http.Post(s.http.URL+route, "application/json", bytes.NewBufferString(body))
+	s.Require().Nil(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+}
+
+func (s *ServerSuite) graphql(query string, vars map[string]any) graphqlResponse {
+	request, err := json.Marshal(graphqlRequest{Query: query, Variables: vars})
+	s.Require().Nil(err)
+	resp, err := http.Post(s.http.URL+"/graphql", "application/json", bytes.NewBuffer(request))
+	s.Require().Nil(err)
+	defer resp.Body.Close()
+	var response graphqlResponse
+	s.Require().Nil(json.NewDecoder(resp.Body).Decode(&response))
+	return response
+}
+
+func (s *ServerSuite) query(query string, vars map[string]any) string {
+	response := s.graphql(query, vars)
+	s.Require().Empty(response.Errors)
+	data, err := json.Marshal(response.Data)
+	s.Require().Nil(err)
+	return string(data)
+}
@@ -6,14 +6,9 @@ package rollmelette
 
 import (
 	"fmt"
-	"log/slog"
 	"math/big"
-	"os"
-	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/lmittmann/tint"
-	"github.com/mattn/go-isatty"
 )
 
 // MaxUint256 is the max value for uint256.
@@ -51,89 +46,217 @@ type Application interface {
 type EnvInspector interface {
 
 	// Report sends a report.
+	// It panics if the report can't be sent, which rejects the input.
 	Report(payload []byte)
 
-	// AppAddress returns the application address sent by the address relay contract.
-	// If the contract didn't send the address yet, the function returns false.
-	AppAddress() common.Address
+	// TryReport sends a report.
+	// It returns an OutputLimitError if the report exceeds the output limits, or the error of the
+	// Rollup API if it fails to send the report.
+	TryReport(payload []byte) error
+
+	// AppAddress returns the application address.
+	// Rollmelette learns the address from the run options, from the advance metadata, or from
+	// the address relay contract. If the address is still unknown, the function returns false.
+	AppAddress() (common.Address, bool)
+
+	// ScheduledActions returns the ids of the scheduled actions that didn't run yet.
+	ScheduledActions() []int
 
 	// EtherAddresses returns the list of addresses that have Ether.
 	EtherAddresses() []common.Address
 
-	// EtherBalanceOf returns the balance of the given address.
+	// EtherBalanceOf returns the balance of the given address, including the locked funds.
 	EtherBalanceOf(address common.Address) *big.Int
 
+	// EtherAvailableOf returns the balance of the given address that isn't locked.
+	EtherAvailableOf(address common.Address) *big.Int
+
+	// EtherLockedOf returns the Ether locked by the given address for every reason.
+	EtherLockedOf(address common.Address) *big.Int
+
+	// EtherLocks returns the Ether locks of the given address, sorted by reason.
+	EtherLocks(address common.Address) []Lock
+
 	// ERC20Tokens returns the list of tokens that have a non-zero balance in the application.
 	ERC20Tokens() []common.Address
 
 	// ERC20Addresses returns the list of addresses that have the given token.
 	ERC20Addresses(token common.Address) []common.Address
 
-	// ERC20BalanceOf returns the balance of the given address for the given token.
+	// ERC20BalanceOf returns the balance of the given address for the given token, including
+	// the locked funds.
 	ERC20BalanceOf(token common.Address, address common.Address) *big.Int
+
+	// ERC20AvailableOf returns the balance of the given address for the given token that isn't
+	// locked.
+	ERC20AvailableOf(token common.Address, address common.Address) *big.Int
+
+	// ERC20LockedOf returns the tokens locked by the given address for every reason.
+	ERC20LockedOf(token common.Address, address common.Address) *big.Int
+
+	// ERC20Locks returns the locks of the given address for the given token, sorted by reason.
+	ERC20Locks(token common.Address, address common.Address) []Lock
+
+	// NativeTokens returns the native tokens created by the application, sorted by address.
+	NativeTokens() []NativeToken
+
+	// NativeToken returns the metadata of the native token with the given address.
+	// If the token doesn't exist, it returns false.
+	NativeToken(token common.Address) (NativeToken, bool)
+
+	// NativeAddresses returns the list of addresses that have the given native token.
+	NativeAddresses(token common.Address) []common.Address
+
+	// NativeBalanceOf returns the balance of the given address for the given native token.
+	NativeBalanceOf(token common.Address, address common.Address) *big.Int
+
+	// NativeTotalSupply returns the amount of the given native token in the application.
+	NativeTotalSupply(token common.Address) *big.Int
 }
 
 // Env is the entrypoint for the Rollup API and to Rollmelette's asset management.
+// The wallet methods return an InvalidValueError if the value is nil, negative, or greater than
+// MaxUint256. The transfers and withdrawals only use the funds that aren't locked.
 type Env interface {
 	EnvInspector
 
 	// Voucher sends a voucher and returns its index.
+	// It panics if the voucher can't be sent, which rejects the input.
 	Voucher(destination common.Address, value *big.Int, payload []byte) int
 
+	// TryVoucher is like Voucher, but it returns an error instead of panicking.
+	// It returns an OutputLimitError if the voucher exceeds the output limits.
+	TryVoucher(destination common.Address, value *big.Int, payload []byte) (int, error)
+
 	// DelegateCallVoucher delegates a voucher to a new destination.
+	// It panics if the voucher can't be sent, which rejects the input.
 	DelegateCallVoucher(destination common.Address, payload []byte) int
 
+	// TryDelegateCallVoucher is like DelegateCallVoucher, but it returns an error instead of
+	// panicking. It returns an OutputLimitError if the voucher exceeds the output limits.
+	TryDelegateCallVoucher(destination common.Address, payload []byte) (int, error)
+
 	// Notice sends a notice and returns its index.
+	// It panics if the notice can't be sent, which rejects the input.
 	Notice(payload []byte) int
 
+	// TryNotice is like Notice, but it returns an error instead of panicking.
+	// It returns an OutputLimitError if the notice exceeds the output limits.
+	TryNotice(payload []byte) (int, error)
+
 	// EtherTransfer transfers the given amount of funds from source to destination.
-	// It returns an error if source doesn't have enough funds.
+	// It returns an InsufficientFundsError if source doesn't have enough funds.
 	EtherTransfer(src common.Address, dst common.Address, value *big.Int) error
 
-	// EtherWithdraw withdraws the asset from the wallet, generates the voucher to withdraw
-	// it from the application contract, and returns the voucher index.
-	// Before withdrawing Ether, the application must receive its contract address from the
-	// address relay contract.
-	// It returns an error if the address doesn't have enough funds.
+	// EtherWithdraw withdraws the asset from the wallet, generates the voucher that pays it out,
+	// and returns the voucher index. In the v1 portal layout, the voucher calls the withdrawal
+	// function of the application contract; in later releases, it sends the value to the address.
+	// So, in the v1 portal layout, the application must know its contract address.
+	// It returns ErrUnknownAppAddress if the v1 voucher needs the address and it is unknown, and
+	// an InsufficientFundsError if the address doesn't have enough funds. If the voucher can't be
+	// sent, it returns the error and keeps the balance.
 	EtherWithdraw(address common.Address, value *big.Int) (int, error)
 
+	// EtherWithdrawTo works like EtherWithdraw, but the voucher sends the Ether to the recipient
+	// instead of the address whose balance is debited.
+	EtherWithdrawTo(address common.Address, recipient common.Address, value *big.Int) (int, error)
+
 	// ERC20Transfer transfers the given amount of tokens from source to destination.
-	// It returns an error if source doesn't have enough funds.
+	// It returns an InsufficientFundsError if source doesn't have enough funds.
 	ERC20Transfer(token common.Address, src common.Address, dst common.Address, value *big.Int) error
 
 	// ERC20Withdraw withdraws the token from the wallet, generates the voucher to withdraw it
 	// from the ERC20 contract, and returns the voucher index.
-	// It returns an error if the address doesn't have enough funds.
+	// It returns an InsufficientFundsError if the address doesn't have enough funds.
+	// If the voucher can't be sent, it returns the error and keeps the balance.
 	ERC20Withdraw(token common.Address, address common.Address, value *big.Int) (int, error)
 
-	// SetBalance sets the balance of the given address.
+	// ERC20WithdrawTo works like ERC20Withdraw, but the voucher sends the tokens to the recipient
+	// instead of the address whose balance is debited.
+	ERC20WithdrawTo(
+		token common.Address,
+		address common.Address,
+		recipient common.Address,
+		value *big.Int,
+	) (int, error)
+
+	// BatchWithdraw debits the Ether, ERC20, and native token withdrawals all or nothing, and
+	// generates the vouchers that pay them out. The Ether and ERC20 legs pay the withdrawal fee,
+	// and the vouchers pay out the values minus the fees. The payouts of the same asset to the
+	// same recipient are aggregated into a single voucher, and the function returns the voucher
+	// indices in the order of the first withdrawal of each payout.
+	// If a withdrawal fails, it reverts every debit and fee of the batch and returns a
+	// BatchTransferError with the index of the failing withdrawal. It checks the output limits
+	// of every voucher before sending them, so it returns an OutputLimitError without sending any
+	// voucher. If the Rollup API fails on the first voucher, it restores the balances and returns
+	// the error; if it fails after a voucher was sent, it panics, which rejects the input.
+	BatchWithdraw(withdrawals []Withdrawal) ([]int, error)
+
+	// BatchTransfer applies the Ether, ERC20, and native token transfers in order, all or
+	// nothing. If a transfer fails, it reverts the previous transfers and returns a
+	// BatchTransferError with the index of the failing transfer. The Ether and ERC20 legs pay
+	// the same fees as EtherTransfer and ERC20Transfer.
+	BatchTransfer(transfers []Transfer) error
+
+	// EtherLock locks the given amount of Ether of the address for the reason.
+	// The funds stay in the address, but transfers and withdrawals can't use them.
+	// It returns an InsufficientFundsError if the address doesn't have enough available funds.
+	EtherLock(address common.Address, value *big.Int, reason string) error
+
+	// EtherUnlock unlocks the given amount of Ether locked by the address for the reason.
+	// It returns an InsufficientLockedError if the address doesn't have enough funds locked for
+	// the reason.
+	EtherUnlock(address common.Address, value *big.Int, reason string) error
+
+	// ERC20Lock is like EtherLock, but for the given token.
+	ERC20Lock(token common.Address, address common.Address, value *big.Int, reason string) error
+
+	// ERC20Unlock is like EtherUnlock, but for the given token.
+	ERC20Unlock(token common.Address, address common.Address, value *big.Int, reason string) error
+
+	// NativeCreate creates a native token and returns its address, as in NativeTokenAddress.
+	// It returns ErrInvalidToken if the symbol is empty or a token with the symbol exists.
+	NativeCreate(token NativeToken) (common.Address, error)
+
+	// NativeMint mints the given amount of the native token to the address.
+	// It returns ErrUnknownToken if the token doesn't exist, and a BalanceOverflowError if the
+	// total supply would exceed MaxUint256.
+	NativeMint(token common.Address, address common.Address, value *big.Int) error
+
+	// NativeBurn burns the given amount of the native token from the address.
+	// It returns an InsufficientFundsError if the address doesn't have enough funds.
+	NativeBurn(token common.Address, address common.Address, value *big.Int) error
+
+	// NativeTransfer transfers the given amount of the native token from source to destination.
+	// It returns an InsufficientFundsError if source doesn't have enough funds.
+	NativeTransfer(token common.Address, src common.Address, dst common.Address, value *big.Int) error
+
+	// NativeWithdraw burns the native token from the wallet, generates the voucher that calls
+	// mint(address,uint256) in the minter contract of the token, and returns the voucher index.
+	// It returns ErrInvalidToken if the token doesn't have a minter.
+	// If the voucher can't be sent, it returns the error and keeps the balance.
+	NativeWithdraw(token common.Address, address common.Address, value *big.Int) (int, error)
+
+	// SetEtherBalance sets the balance of the given address.
+	// It doesn't change the locks, so the locks may exceed the new balance.
+	// It panics with an InvalidValueError if the value is nil, negative, or greater than
+	// MaxUint256, which rejects the input.
 	SetEtherBalance(address common.Address, value *big.Int)
 
 	// SetERC20Balance sets the balance of the given address for the given token.
+	// It panics with an InvalidValueError if the value is invalid, like SetEtherBalance.
 	SetERC20Balance(token common.Address, address common.Address, value *big.Int)
-}
 
-// init configures the slog package with the tint handler.
-func init() {
-	logOpts := new(tint.Options)
-
-	logOpts.Level = slog.LevelDebug
-	logLevelStr := os.Getenv("ROLLMELETTE_LOG_LEVEL")
-	if logLevelStr != "" {
-		if logLevel, err := strconv.Atoi(logLevelStr); err == nil {
-			logOpts.Level = slog.Level(logLevel)
-		}
-	}
-	logOpts.NoColor = !isatty.IsTerminal(os.Stdout.Fd())
-	// disable timestamp because it is irrelevant in the cartesi machine
-	logOpts.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
-		if attr.Key == slog.TimeKey {
-			var zeroAttr slog.Attr
-			return zeroAttr
-		}
-		return attr
-	}
-	handler := tint.NewHandler(os.Stdout, logOpts)
-	logger := slog.New(handler)
-	slog.SetDefault(logger)
+	// ScheduleAt schedules the action to run at the start of the first advance input whose
+	// block timestamp is greater than or equal to the given timestamp, and returns its id.
+	// The due actions run in the order they were scheduled, before the application handles the
+	// input. If the input is rejected, Rollmelette reverts the changes to the schedule.
+	ScheduleAt(timestamp int64, action ScheduledAction) int
+
+	// ScheduleAtBlock is like ScheduleAt, but it uses the block number of the input.
+	ScheduleAtBlock(blockNumber int64, action ScheduledAction) int
+
+	// CancelScheduled removes the action from the schedule.
+	// It returns false if the action already ran or doesn't exist.
+	CancelScheduled(id int) bool
 }
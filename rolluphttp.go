@@ -19,19 +19,36 @@ import (
 
 // rollupHttp implements the Rollup API by calling the Rollup HTTP server.
 type rollupHttp struct {
-	url string
+	url    string
+	logger *payloadLogger
+	tracer Tracer
 }
 
 // newRollupHttp create a new rollup HTTP client.
-func newRollupHttp(url string) *rollupHttp {
+func newRollupHttp(url string, logger *payloadLogger, tracer Tracer) *rollupHttp {
 	return &rollupHttp{
-		url: url,
+		url:    url,
+		logger: logger,
+		tracer: tracer,
 	}
 }
 
 // rollup interface ////////////////////////////////////////////////////////////////////////////////
 
-func (r *rollupHttp) finishAndGetNext(ctx context.Context, status finishStatus) (any, error) {
+func (r *rollupHttp) finishAndGetNext(ctx context.Context, status finishStatus) (input any, err error) {
+	ctx, span := r.tracer.Start(ctx, SpanFinish, slog.String("status", string(status)))
+	defer func() { endSpan(span, err) }()
+	for {
+		input, err = r.finish(ctx, status)
+		if input != nil || err != nil {
+			return input, err
+		}
+		// if we get StatusAccepted we should trying again
+	}
+}
+
+// finish sends the finish request and returns nil if the server should be called again.
+func (r *rollupHttp) finish(ctx context.Context, status finishStatus) (any, error) {
 	request := struct {
 		Status string `json:"status"`
 	}{
@@ -43,8 +60,7 @@ func (r *rollupHttp) finishAndGetNext(ctx context.Context, status finishStatus)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusAccepted {
-		// if we get StatusAccepted we should trying again
-		return r.finishAndGetNext(ctx, status)
+		return nil, nil
 	}
 	if err = checkStatusOk(resp); err != nil {
 		return nil, err
@@ -66,7 +82,9 @@ func (r *rollupHttp) finishAndGetNext(ctx context.Context, status finishStatus)
 	}
 }
 
-func (r *rollupHttp) sendVoucher(ctx context.Context, destination common.Address, value *big.Int, payload []byte) (int, error) {
+func (r *rollupHttp) sendVoucher(ctx context.Context, destination common.Address, value *big.Int, payload []byte) (_ int, err error) {
+	ctx, span := r.startOutputSpan(ctx, "voucher", payload)
+	defer func() { endSpan(span, err) }()
 	paddedBytes := common.LeftPadBytes(value.Bytes(), 32) // nolint
 	request := struct {
 		Destination string `json:"destination"`
@@ -77,7 +95,8 @@ func (r *rollupHttp) sendVoucher(ctx context.Context, destination common.Address
 		Value:       "0x" + common.Bytes2Hex(paddedBytes),
 		Payload:     hexutil.Encode(payload),
 	}
-	slog.Debug("SendVoucher", "request", request)
+	r.logger.debug(ctx, "SendVoucher", LogRouteVoucher, payload,
+		"destination", request.Destination, "value", request.Value)
 	resp, err := r.sendPost(ctx, "voucher", request)
 	if err != nil {
 		return 0, err
@@ -89,7 +108,9 @@ func (r *rollupHttp) sendVoucher(ctx context.Context, destination common.Address
 	return parseOutputIndex(resp.Body)
 }
 
-func (r *rollupHttp) sendDelegateCallVoucher(ctx context.Context, destination common.Address, payload []byte) (int, error) {
+func (r *rollupHttp) sendDelegateCallVoucher(ctx context.Context, destination common.Address, payload []byte) (_ int, err error) {
+	ctx, span := r.startOutputSpan(ctx, "delegate-call-voucher", payload)
+	defer func() { endSpan(span, err) }()
 	request := struct {
 		Destination string `json:"destination"`
 		Payload     string `json:"payload"`
@@ -108,7 +129,9 @@ func (r *rollupHttp) sendDelegateCallVoucher(ctx context.Context, destination co
 	return parseOutputIndex(resp.Body)
 }
 
-func (r *rollupHttp) sendNotice(ctx context.Context, payload []byte) (int, error) {
+func (r *rollupHttp) sendNotice(ctx context.Context, payload []byte) (_ int, err error) {
+	ctx, span := r.startOutputSpan(ctx, "notice", payload)
+	defer func() { endSpan(span, err) }()
 	request := struct {
 		Payload string `json:"payload"`
 	}{
@@ -125,7 +148,9 @@ func (r *rollupHttp) sendNotice(ctx context.Context, payload []byte) (int, error
 	return parseOutputIndex(resp.Body)
 }
 
-func (r *rollupHttp) sendReport(ctx context.Context, payload []byte) error {
+func (r *rollupHttp) sendReport(ctx context.Context, payload []byte) (err error) {
+	ctx, span := r.startOutputSpan(ctx, "report", payload)
+	defer func() { endSpan(span, err) }()
 	request := struct {
 		Payload string `json:"payload"`
 	}{
@@ -144,6 +169,11 @@ func (r *rollupHttp) sendReport(ctx context.Context, payload []byte) error {
 
 // helpers /////////////////////////////////////////////////////////////////////////////////////////
 
+// startOutputSpan starts the span of a call to the output route.
+func (r *rollupHttp) startOutputSpan(ctx context.Context, route string, payload []byte) (context.Context, Span) {
+	return r.tracer.Start(ctx, "rollup."+route, slog.Int("payloadSize", len(payload)))
+}
+
 // sendPost sends a POST request and returns the HTTP response.
 // The callee should close the response body.
 func (r *rollupHttp) sendPost(ctx context.Context, route string, request any) (*http.Response, error) {
@@ -195,7 +225,7 @@ func parseAdvanceInput(data json.RawMessage) (any, error) {
 	if err != nil {
 		return nil, fmt.Errorf("rollup: decode advance payload: %w", err)
 	}
-	appContract, err := hexutil.Decode(advanceRequest.Metadata.AppContract)
+	appContract, err := decodeOptionalHex(advanceRequest.Metadata.AppContract)
 	if err != nil {
 		return nil, fmt.Errorf("rollup: decode advance metadata app_contract: %w", err)
 	}
@@ -203,13 +233,13 @@ func parseAdvanceInput(data json.RawMessage) (any, error) {
 	if err != nil {
 		return nil, fmt.Errorf("rollup: decode advance metadata sender: %w", err)
 	}
-	prevRandao, err := hexutil.Decode(advanceRequest.Metadata.PrevRandao)
+	prevRandao, err := decodeOptionalHex(advanceRequest.Metadata.PrevRandao)
 	if err != nil {
 		return nil, fmt.Errorf("rollup: decode advance metadata prev_randao: %w", err)
 	}
 	metadata := Metadata{
 		ChainId:        advanceRequest.Metadata.ChainId,
-		AppContract:    common.Address(appContract),
+		AppContract:    common.BytesToAddress(appContract),
 		MsgSender:      common.Address(sender),
 		BlockNumber:    advanceRequest.Metadata.BlockNumber,
 		BlockTimestamp: advanceRequest.Metadata.BlockTimestamp,
@@ -240,6 +270,14 @@ func parseInspectInput(data json.RawMessage) (any, error) {
 	return input, nil
 }
 
+// decodeOptionalHex decodes a hex string that older versions of the Rollup API don't send.
+func decodeOptionalHex(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return hexutil.Decode(s)
+}
+
 func checkStatusOk(resp *http.Response) error {
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		body, err := io.ReadAll(resp.Body)
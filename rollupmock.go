@@ -5,13 +5,19 @@ package rollmelette
 
 import (
 	"context"
+	"maps"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
 
 // TestVoucher represents a voucher received by the mock.
+// Index is the voucher index returned to the application.
+// InputIndex is the index of the advance input that sent the voucher.
 type TestVoucher struct {
+	Index       int
+	InputIndex  int
 	Destination common.Address
 	Value       *big.Int
 	Payload     []byte
@@ -19,26 +25,81 @@ type TestVoucher struct {
 
 // TestDelegateCallVoucher represents a delegate call voucher received by the mock.
 type TestDelegateCallVoucher struct {
+	Index       int
+	InputIndex  int
 	Destination common.Address
 	Payload     []byte
 }
 
 // TestNotice represents a notice received by the mock.
 type TestNotice struct {
-	Payload []byte
+	Index      int
+	InputIndex int
+	Payload    []byte
 }
 
 // TestReport represents a report received by the mock.
+// InputIndex is zero for the reports of inspect inputs.
 type TestReport struct {
-	Payload []byte
+	InputIndex int
+	Payload    []byte
 }
 
-// rollupHttp implements the Rollup API by calling the Rollup HTTP server.
+// TestHistory contains the outputs received by the mock across all inputs.
+// It contains the vouchers and notices of the accepted advance inputs, and the reports of every
+// advance input, like the Rollup API.
+type TestHistory struct {
+	Vouchers             []TestVoucher
+	DelegateCallVouchers []TestDelegateCallVoucher
+	Notices              []TestNotice
+	Reports              []TestReport
+}
+
+// TestFault scripts a failure of the rollup mock used by the Tester.
+type TestFault struct {
+	// Route is the output route that fails, such as LogRouteNotice.
+	Route string
+
+	// Call is the call of the route that fails, counting from one after the fault is injected.
+	// If it is zero, every call of the route fails.
+	Call int
+
+	// Err is the error returned by the call.
+	Err error
+
+	// Delay delays the response of the call.
+	// If the input context is done during the delay, the call returns the context error.
+	Delay time.Duration
+
+	// IndexGap is skipped by the indices returned by the route from this call on, as if other
+	// outputs were sent in between.
+	IndexGap int
+
+	// Cancel cancels the input context before the call, so the call returns context.Canceled.
+	Cancel bool
+}
+
+// mockFault is a fault injected in the mock.
+type mockFault struct {
+	TestFault
+	calls int
+}
+
+// rollupMock implements the Rollup API for the Tester.
+// Like the Rollup API, the output indices start from zero, grow across inputs, and are counted
+// separately for each output type.
 type rollupMock struct {
 	Vouchers             []TestVoucher
 	DelegateCallVouchers []TestDelegateCallVoucher
 	Notices              []TestNotice
 	Reports              []TestReport
+	history              TestHistory
+	inputIndex           int
+	indices              map[string]int
+	inputIndices         map[string]int
+	limits               OutputLimits
+	faults               []*mockFault
+	cancel               context.CancelFunc
 }
 
 // rollup interface ////////////////////////////////////////////////////////////////////////////////
@@ -49,41 +110,155 @@ func (m *rollupMock) sendVoucher(
 	value *big.Int,
 	payload []byte,
 ) (int, error) {
+	if err := m.applyFaults(ctx, LogRouteVoucher); err != nil {
+		return 0, err
+	}
+	if err := m.limits.check(LogRouteVoucher, m.outputs(), payload); err != nil {
+		return 0, err
+	}
+	index := m.nextIndex(LogRouteVoucher)
 	m.Vouchers = append(m.Vouchers, TestVoucher{
+		Index:       index,
+		InputIndex:  m.inputIndex,
 		Destination: destination,
 		Value:       value,
 		Payload:     payload,
 	})
-	return len(m.Vouchers), nil
+	return index, nil
 }
 
 func (m *rollupMock) sendDelegateCallVoucher(ctx context.Context, destination common.Address, payload []byte) (int, error) {
+	if err := m.applyFaults(ctx, LogRouteDelegateCallVoucher); err != nil {
+		return 0, err
+	}
+	if err := m.limits.check(LogRouteDelegateCallVoucher, m.outputs(), payload); err != nil {
+		return 0, err
+	}
+	index := m.nextIndex(LogRouteDelegateCallVoucher)
 	m.DelegateCallVouchers = append(m.DelegateCallVouchers, TestDelegateCallVoucher{
+		Index:       index,
+		InputIndex:  m.inputIndex,
 		Destination: destination,
 		Payload:     payload,
 	})
-	return len(m.DelegateCallVouchers), nil
+	return index, nil
 }
 
 func (m *rollupMock) sendNotice(ctx context.Context, payload []byte) (int, error) {
+	if err := m.applyFaults(ctx, LogRouteNotice); err != nil {
+		return 0, err
+	}
+	if err := m.limits.check(LogRouteNotice, m.outputs(), payload); err != nil {
+		return 0, err
+	}
+	index := m.nextIndex(LogRouteNotice)
 	m.Notices = append(m.Notices, TestNotice{
-		Payload: payload,
+		Index:      index,
+		InputIndex: m.inputIndex,
+		Payload:    payload,
 	})
-	return len(m.Notices), nil
+	return index, nil
 }
 
 func (m *rollupMock) sendReport(ctx context.Context, payload []byte) error {
+	if err := m.applyFaults(ctx, LogRouteReport); err != nil {
+		return err
+	}
+	if err := m.limits.check(LogRouteReport, m.outputs(), payload); err != nil {
+		return err
+	}
 	m.Reports = append(m.Reports, TestReport{
-		Payload: payload,
+		InputIndex: m.inputIndex,
+		Payload:    payload,
 	})
 	return nil
 }
 
 // mock functions /////////////////////////////////////////////////////////////////////////////////
 
-func (m *rollupMock) reset() {
+// inject adds the fault to the mock.
+func (m *rollupMock) inject(fault TestFault) {
+	m.faults = append(m.faults, &mockFault{TestFault: fault})
+}
+
+// clearFaults removes the faults from the mock.
+// The index gaps persist, like the indices of the Rollup API.
+func (m *rollupMock) clearFaults() {
+	m.faults = nil
+}
+
+// applyFaults applies the faults of the given route to the current call.
+func (m *rollupMock) applyFaults(ctx context.Context, route string) error {
+	for _, fault := range m.faults {
+		if fault.Route != route {
+			continue
+		}
+		fault.calls++
+		if fault.Call != 0 && fault.Call != fault.calls {
+			continue
+		}
+		if fault.Cancel && m.cancel != nil {
+			m.cancel()
+		}
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-ctx.Done():
+			}
+		}
+		if fault.IndexGap > 0 {
+			m.skipIndices(route, fault.IndexGap)
+		}
+		if fault.Err != nil {
+			return fault.Err
+		}
+	}
+	return ctx.Err()
+}
+
+// outputs returns the number of vouchers and notices sent since the last reset.
+func (m *rollupMock) outputs() int {
+	return len(m.Vouchers) + len(m.DelegateCallVouchers) + len(m.Notices)
+}
+
+// nextIndex returns the next output index of the route.
+func (m *rollupMock) nextIndex(route string) int {
+	if m.indices == nil {
+		m.indices = make(map[string]int)
+	}
+	index := m.indices[route]
+	m.indices[route]++
+	return index
+}
+
+// skipIndices skips the next n output indices of the route.
+func (m *rollupMock) skipIndices(route string, n int) {
+	if m.indices == nil {
+		m.indices = make(map[string]int)
+	}
+	m.indices[route] += n
+}
+
+// begin clears the outputs of the previous input and starts a new one.
+// For inspect inputs, the input index should be zero.
+func (m *rollupMock) begin(inputIndex int) {
 	m.Vouchers = nil
 	m.DelegateCallVouchers = nil
 	m.Notices = nil
 	m.Reports = nil
+	m.inputIndex = inputIndex
+	m.inputIndices = maps.Clone(m.indices)
+}
+
+// finishAdvance adds the outputs of the advance input to the history.
+// If the input was rejected, the mock discards its vouchers and notices and reuses their indices.
+func (m *rollupMock) finishAdvance(accepted bool) {
+	if accepted {
+		m.history.Vouchers = append(m.history.Vouchers, m.Vouchers...)
+		m.history.DelegateCallVouchers = append(m.history.DelegateCallVouchers, m.DelegateCallVouchers...)
+		m.history.Notices = append(m.history.Notices, m.Notices...)
+	} else {
+		m.indices = m.inputIndices
+	}
+	m.history.Reports = append(m.history.Reports, m.Reports...)
 }
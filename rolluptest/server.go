@@ -0,0 +1,496 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+// Package rolluptest provides an in-process implementation of the Rollup HTTP API, so
+// applications can be tested end-to-end with rollmelette.Run without a Cartesi node.
+package rolluptest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ErrClosed is returned when the server is closed before the input is processed.
+var ErrClosed = errors.New("rolluptest: server closed")
+
+// Status is the completion status of an input.
+type Status string
+
+const (
+	StatusAccepted  Status = "accepted"
+	StatusRejected  Status = "rejected"
+	StatusException Status = "exception"
+)
+
+// Voucher is a voucher sent by the application.
+type Voucher struct {
+	Index       int
+	Destination common.Address
+	Value       *big.Int
+	Payload     []byte
+}
+
+// DelegateCallVoucher is a delegate call voucher sent by the application.
+type DelegateCallVoucher struct {
+	Index       int
+	Destination common.Address
+	Payload     []byte
+}
+
+// Notice is a notice sent by the application.
+type Notice struct {
+	Index   int
+	Payload []byte
+}
+
+// Report is a report sent by the application.
+type Report struct {
+	Payload []byte
+}
+
+// AdvanceResult contains the outputs of an advance input.
+type AdvanceResult struct {
+	Index                int
+	Status               Status
+	Vouchers             []Voucher
+	DelegateCallVouchers []DelegateCallVoucher
+	Notices              []Notice
+	Reports              []Report
+
+	// Exception is the payload sent to the exception route, if the status is StatusException.
+	Exception []byte
+}
+
+// InspectResult contains the outputs of an inspect input.
+type InspectResult struct {
+	Status    Status
+	Reports   []Report
+	Exception []byte
+}
+
+// ServerOpts allows the test to pass some parameters to the server.
+type ServerOpts struct {
+	// ChainId is the chain id sent in the advance metadata.
+	ChainId int64
+
+	// AppContract is the application address sent in the advance metadata.
+	AppContract common.Address
+
+	// FinishTimeout is the time the server waits for the next input before it responds to the
+	// finish request with the status 202, so the application calls finish again.
+	FinishTimeout time.Duration
+}
+
+// NewServerOpts creates a ServerOpts struct with sensible default values.
+func NewServerOpts() *ServerOpts {
+	var opts ServerOpts
+	opts.ChainId = 1
+	opts.AppContract = common.HexToAddress("0xab7528bb862fb57e8a2bcd567a2e929a0be56a5e")
+	opts.FinishTimeout = time.Second
+	return &opts
+}
+
+// input is an input waiting to be processed by the application.
+type input struct {
+	sender  common.Address
+	payload []byte
+	advance bool
+	result  AdvanceResult
+	done    chan struct{}
+}
+
+// Server is an in-process Rollup HTTP server.
+// The application connects to the server URL, and the test sends inputs with the Advance and
+// Inspect methods. Like the Rollup API, the output indices start from zero, grow across inputs,
+// and are counted separately for each output type.
+type Server struct {
+	// URL is the base URL of the server, which should be passed to RunOpts.RollupURL.
+	URL string
+
+	opts       ServerOpts
+	httpServer *httptest.Server
+	inputs     chan *input
+	closed     chan struct{}
+	closeOnce  sync.Once
+
+	mutex        sync.Mutex
+	current      *input
+	inputIndex   int
+	indices      map[string]int
+	inputIndices map[string]int
+}
+
+// NewServer creates and starts a server with the default options.
+func NewServer() *Server {
+	return NewServerWithOpts(nil)
+}
+
+// NewServerWithOpts creates and starts a server with the given options.
+// If opts is nil, this function creates it with the NewServerOpts function.
+func NewServerWithOpts(opts *ServerOpts) *Server {
+	if opts == nil {
+		opts = NewServerOpts()
+	}
+	s := &Server{
+		opts:    *opts,
+		inputs:  make(chan *input),
+		closed:  make(chan struct{}),
+		indices: make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/finish", s.handleFinish)
+	mux.HandleFunc("/voucher", s.handleVoucher)
+	mux.HandleFunc("/delegate-call-voucher", s.handleDelegateCallVoucher)
+	mux.HandleFunc("/notice", s.handleNotice)
+	mux.HandleFunc("/report", s.handleReport)
+	mux.HandleFunc("/exception", s.handleException)
+	s.httpServer = httptest.NewServer(mux)
+	s.URL = s.httpServer.URL
+	return s
+}
+
+// Close stops the server.
+// The inputs waiting to be processed return ErrClosed.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.httpServer.Close()
+	})
+}
+
+// Advance sends an advance input and waits for the application to process it.
+func (s *Server) Advance(ctx context.Context, sender common.Address, payload []byte) (*AdvanceResult, error) {
+	in, err := s.send(ctx, &input{sender: sender, payload: payload, advance: true})
+	if err != nil {
+		return nil, err
+	}
+	return &in.result, nil
+}
+
+// Inspect sends an inspect input and waits for the application to process it.
+func (s *Server) Inspect(ctx context.Context, payload []byte) (*InspectResult, error) {
+	in, err := s.send(ctx, &input{payload: payload})
+	if err != nil {
+		return nil, err
+	}
+	result := &InspectResult{
+		Status:    in.result.Status,
+		Reports:   in.result.Reports,
+		Exception: in.result.Exception,
+	}
+	return result, nil
+}
+
+// send hands the input to the application and waits for the result.
+func (s *Server) send(ctx context.Context, in *input) (*input, error) {
+	in.done = make(chan struct{})
+	select {
+	case s.inputs <- in:
+	case <-s.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case <-in.done:
+		return in, nil
+	case <-s.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// handlers ////////////////////////////////////////////////////////////////////////////////////////
+
+func (s *Server) handleFinish(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Status string `json:"status"`
+	}
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	var status Status
+	switch request.Status {
+	case "accept":
+		status = StatusAccepted
+	case "reject":
+		status = StatusRejected
+	default:
+		http.Error(w, fmt.Sprintf("invalid status: %v", request.Status), http.StatusBadRequest)
+		return
+	}
+	s.finishCurrent(status, nil)
+
+	timer := time.NewTimer(s.opts.FinishTimeout)
+	defer timer.Stop()
+	select {
+	case in := <-s.inputs:
+		s.writeInput(w, in)
+	case <-timer.C:
+		w.WriteHeader(http.StatusAccepted)
+	case <-s.closed:
+		http.Error(w, ErrClosed.Error(), http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+func (s *Server) handleVoucher(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Destination string `json:"destination"`
+		Value       string `json:"value"`
+		Payload     string `json:"payload"`
+	}
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	destination, ok := decodeAddress(w, request.Destination)
+	if !ok {
+		return
+	}
+	value, ok := decodeHex(w, "value", request.Value)
+	if !ok {
+		return
+	}
+	if len(value) > common.HashLength {
+		http.Error(w, "invalid value size", http.StatusBadRequest)
+		return
+	}
+	payload, ok := decodeHex(w, "payload", request.Payload)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.checkAdvance(w) {
+		return
+	}
+	index := s.nextIndex("voucher")
+	s.current.result.Vouchers = append(s.current.result.Vouchers, Voucher{
+		Index:       index,
+		Destination: destination,
+		Value:       new(big.Int).SetBytes(value),
+		Payload:     payload,
+	})
+	writeIndex(w, index)
+}
+
+func (s *Server) handleDelegateCallVoucher(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Destination string `json:"destination"`
+		Payload     string `json:"payload"`
+	}
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	destination, ok := decodeAddress(w, request.Destination)
+	if !ok {
+		return
+	}
+	payload, ok := decodeHex(w, "payload", request.Payload)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.checkAdvance(w) {
+		return
+	}
+	index := s.nextIndex("delegate-call-voucher")
+	s.current.result.DelegateCallVouchers = append(s.current.result.DelegateCallVouchers,
+		DelegateCallVoucher{
+			Index:       index,
+			Destination: destination,
+			Payload:     payload,
+		})
+	writeIndex(w, index)
+}
+
+func (s *Server) handleNotice(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Payload string `json:"payload"`
+	}
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	payload, ok := decodeHex(w, "payload", request.Payload)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.checkAdvance(w) {
+		return
+	}
+	index := s.nextIndex("notice")
+	s.current.result.Notices = append(s.current.result.Notices, Notice{
+		Index:   index,
+		Payload: payload,
+	})
+	writeIndex(w, index)
+}
+
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Payload string `json:"payload"`
+	}
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	payload, ok := decodeHex(w, "payload", request.Payload)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.current == nil {
+		http.Error(w, "no input being processed", http.StatusBadRequest)
+		return
+	}
+	s.current.result.Reports = append(s.current.result.Reports, Report{Payload: payload})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleException(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Payload string `json:"payload"`
+	}
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	payload, ok := decodeHex(w, "payload", request.Payload)
+	if !ok {
+		return
+	}
+	if !s.finishCurrent(StatusException, payload) {
+		http.Error(w, "no input being processed", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// helpers /////////////////////////////////////////////////////////////////////////////////////////
+
+// finishCurrent completes the current input with the given status.
+// It returns false if there is no current input.
+func (s *Server) finishCurrent(status Status, exception []byte) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	in := s.current
+	if in == nil {
+		return false
+	}
+	s.current = nil
+	if in.advance && status != StatusAccepted {
+		// the rollup discards the outputs of the input, so their indices are reused
+		s.indices = s.inputIndices
+	}
+	in.result.Status = status
+	in.result.Exception = exception
+	close(in.done)
+	return true
+}
+
+// writeInput makes the input the current one and writes the finish response.
+func (s *Server) writeInput(w http.ResponseWriter, in *input) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.current = in
+	var response any
+	if in.advance {
+		in.result.Index = s.inputIndex
+		s.inputIndex++
+		s.inputIndices = maps.Clone(s.indices)
+		response = map[string]any{
+			"request_type": "advance_state",
+			"data": map[string]any{
+				"metadata": map[string]any{
+					"chain_id":        s.opts.ChainId,
+					"app_contract":    hexutil.Encode(s.opts.AppContract[:]),
+					"msg_sender":      hexutil.Encode(in.sender[:]),
+					"index":           in.result.Index,
+					"block_number":    in.result.Index,
+					"block_timestamp": time.Now().Unix(),
+					"prev_randao":     hexutil.Encode(common.LeftPadBytes([]byte{1}, common.HashLength)),
+				},
+				"payload": hexutil.Encode(in.payload),
+			},
+		}
+	} else {
+		response = map[string]any{
+			"request_type": "inspect_state",
+			"data": map[string]any{
+				"payload": hexutil.Encode(in.payload),
+			},
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// checkAdvance writes an error if the current input isn't an advance input.
+// The caller should hold the mutex.
+func (s *Server) checkAdvance(w http.ResponseWriter) bool {
+	if s.current == nil || !s.current.advance {
+		http.Error(w, "no advance input being processed", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// nextIndex returns the next output index of the route.
+// The caller should hold the mutex.
+func (s *Server) nextIndex(route string) int {
+	index := s.indices[route]
+	s.indices[route]++
+	return index
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, request any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func decodeHex(w http.ResponseWriter, field string, value string) ([]byte, bool) {
+	data, err := hexutil.Decode(value)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid %v: %v", field, err), http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
+
+func decodeAddress(w http.ResponseWriter, value string) (common.Address, bool) {
+	data, ok := decodeHex(w, "destination", value)
+	if !ok {
+		return common.Address{}, false
+	}
+	if len(data) != common.AddressLength {
+		http.Error(w, "invalid destination size", http.StatusBadRequest)
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(data), true
+}
+
+func writeIndex(w http.ResponseWriter, index int) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"index": index})
+}
@@ -0,0 +1,181 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rolluptest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rollmelette/rollmelette"
+	"github.com/rollmelette/rollmelette/examples/echoapp"
+	"github.com/rollmelette/rollmelette/examples/errorapp"
+	"github.com/stretchr/testify/suite"
+)
+
+const testTimeout = 5 * time.Second
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+type ServerSuite struct {
+	suite.Suite
+	ctx     context.Context
+	cancel  context.CancelFunc
+	server  *Server
+	runErr  chan error
+	running bool
+	sender  common.Address
+}
+
+func (s *ServerSuite) SetupTest() {
+	s.ctx, s.cancel = context.WithTimeout(context.Background(), testTimeout)
+	opts := NewServerOpts()
+	opts.FinishTimeout = 10 * time.Millisecond
+	s.server = NewServerWithOpts(opts)
+	s.runErr = make(chan error, 1)
+	s.running = false
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *ServerSuite) TearDownTest() {
+	s.cancel()
+	s.server.Close()
+	if !s.running {
+		return
+	}
+	select {
+	case <-s.runErr:
+	case <-time.After(testTimeout):
+		s.Fail("run didn't stop")
+	}
+}
+
+func (s *ServerSuite) run(app rollmelette.Application) {
+	opts := rollmelette.NewRunOpts()
+	opts.RollupURL = s.server.URL
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s.running = true
+	go func() {
+		s.runErr <- rollmelette.Run(s.ctx, opts, app)
+	}()
+}
+
+func (s *ServerSuite) TestEchoApplication() {
+	s.run(new(echoapp.EchoApplication))
+	payload := []byte("deadbeef")
+
+	// wait for the long-poll timeout, so the app calls finish again
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		result, err := s.server.Advance(s.ctx, s.sender, payload)
+		s.Require().Nil(err)
+		s.Equal(i, result.Index)
+		s.Equal(StatusAccepted, result.Status)
+		s.Require().Len(result.Vouchers, 1)
+		s.Equal(i, result.Vouchers[0].Index)
+		s.Equal(s.sender, result.Vouchers[0].Destination)
+		s.Zero(result.Vouchers[0].Value.Cmp(big.NewInt(0)))
+		s.Equal(payload, result.Vouchers[0].Payload)
+		s.Equal([]Notice{{Index: i, Payload: payload}}, result.Notices)
+		s.Equal([]Report{{Payload: payload}}, result.Reports)
+	}
+
+	result, err := s.server.Inspect(s.ctx, payload)
+	s.Require().Nil(err)
+	s.Equal(StatusAccepted, result.Status)
+	s.Equal([]Report{{Payload: payload}}, result.Reports)
+}
+
+func (s *ServerSuite) TestErrorApplication() {
+	s.run(new(errorapp.ErrorApplication))
+
+	result, err := s.server.Advance(s.ctx, s.sender, nil)
+	s.Require().Nil(err)
+	s.Equal(StatusRejected, result.Status)
+
+	inspectResult, err := s.server.Inspect(s.ctx, nil)
+	s.Require().Nil(err)
+	s.Equal(StatusRejected, inspectResult.Status)
+}
+
+func (s *ServerSuite) TestRejectedOutputIndices() {
+	app := &rejectApplication{}
+	s.run(app)
+
+	result, err := s.server.Advance(s.ctx, s.sender, []byte("reject"))
+	s.Require().Nil(err)
+	s.Equal(StatusRejected, result.Status)
+	s.Equal(0, result.Notices[0].Index)
+
+	// the index of the rejected notice is reused
+	result, err = s.server.Advance(s.ctx, s.sender, nil)
+	s.Require().Nil(err)
+	s.Equal(StatusAccepted, result.Status)
+	s.Equal(1, result.Index)
+	s.Equal(0, result.Notices[0].Index)
+}
+
+func (s *ServerSuite) TestException() {
+	done := make(chan *AdvanceResult)
+	go func() {
+		result, err := s.server.Advance(s.ctx, s.sender, nil)
+		s.Nil(err)
+		done <- result
+	}()
+	s.post("/finish", `{"status":"accept"}`, http.StatusOK)
+	s.post("/exception", `{"payload":"0xdeadbeef"}`, http.StatusOK)
+	result := <-done
+	s.Equal(StatusException, result.Status)
+	s.Equal(common.Hex2Bytes("deadbeef"), result.Exception)
+}
+
+func (s *ServerSuite) TestInvalidRequests() {
+	s.post("/finish", `{"status":"maybe"}`, http.StatusBadRequest)
+	s.post("/notice", `{"payload":"0xdeadbeef"}`, http.StatusBadRequest)
+	s.post("/report", `{"payload":"deadbeef"}`, http.StatusBadRequest)
+	s.post("/voucher", `{"destination":"0xfafa","value":"0x","payload":"0x"}`, http.StatusBadRequest)
+}
+
+func (s *ServerSuite) TestClose() {
+	s.server.Close()
+	_, err := s.server.Advance(s.ctx, s.sender, nil)
+	s.ErrorIs(err, ErrClosed)
+}
+
+func (s *ServerSuite) post(route string, body string, status int) {
+	resp, err := http.Post(s.server.URL+route, "application/json", bytes.NewBufferString(body))
+	s.Require().Nil(err)
+	defer resp.Body.Close()
+	s.Equal(status, resp.StatusCode)
+}
+
+// rejectApplication sends a notice and rejects the inputs with the reject payload.
+type rejectApplication struct{}
+
+func (a *rejectApplication) Advance(
+	env rollmelette.Env,
+	metadata rollmelette.Metadata,
+	deposit rollmelette.Deposit,
+	payload []byte,
+) error {
+	env.Notice(payload)
+	if string(payload) == "reject" {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+func (a *rejectApplication) Inspect(env rollmelette.EnvInspector, payload []byte) error {
+	return nil
+}
@@ -5,6 +5,10 @@ package rollmelette
 
 import (
 	"context"
+	"log/slog"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // RunOpts allows the application developer to pass some parameters to the run function.
@@ -13,6 +17,53 @@ type RunOpts struct {
 
 	// RollupURL is the URL of the Rollup API.
 	RollupURL string
+
+	// AppAddress is the address of the application contract.
+	// It may be left empty, in which case Rollmelette learns the address from the advance
+	// metadata or from the address relay contract.
+	AppAddress common.Address
+
+	// Logger is the logger used by Rollmelette.
+	// If it is nil, Run creates a logger that writes to stdout with the given level and format,
+	// and sets it as the default slog logger.
+	Logger *slog.Logger
+
+	// LogLevel is the minimum level of the log messages.
+	LogLevel slog.Level
+
+	// LogFormat is the format of the log messages.
+	LogFormat LogFormat
+
+	// LogPolicy controls how Rollmelette logs the payloads of inputs and outputs.
+	LogPolicy LogPolicy
+
+	// Metrics receives the execution metrics of each input.
+	// If it is nil, Rollmelette doesn't measure the inputs.
+	// Use a PrometheusMetrics sink to export the metrics to Prometheus.
+	Metrics MetricsSink
+
+	// MetricsAddr is the address where Run serves the metrics, such as ":9100".
+	// If it is set and Metrics is nil, Run records the metrics in a PrometheusMetrics sink.
+	// The Metrics sink must implement http.Handler to be served.
+	MetricsAddr string
+
+	// MeasureMemory enables the AllocatedBytes metric.
+	// It is disabled by default because runtime.ReadMemStats stops the world twice per input.
+	MeasureMemory bool
+
+	// Tracer creates the spans of each input.
+	// If it is nil, Rollmelette doesn't trace the inputs.
+	Tracer Tracer
+
+	// OutputLimits limits the outputs of each input before sending them to the Rollup API.
+	OutputLimits OutputLimits
+
+	// Fees is the fee policy of the wallet operations.
+	Fees FeePolicy
+
+	// Tokens is the registry used to display the ERC20 token amounts.
+	// If it is nil, Rollmelette creates it with the NewTokenRegistry function.
+	Tokens TokenRegistry
 }
 
 // NewRunOpts creates a RunOpts struct with sensible default values.
@@ -20,6 +71,8 @@ func NewRunOpts() *RunOpts {
 	var opts RunOpts
 	opts.AddressBook = NewAddressBook()
 	opts.RollupURL = "http://127.0.0.1:5004"
+	opts.LogLevel = defaultLogLevel()
+	opts.LogFormat = LogFormatTint
 	return &opts
 }
 
@@ -29,15 +82,53 @@ func Run(ctx context.Context, opts *RunOpts, app Application) (err error) {
 	if opts == nil {
 		opts = NewRunOpts()
 	}
-	rollup := newRollupHttp(opts.RollupURL)
-	env := newEnv(ctx, opts.AddressBook, rollup, app)
+	if err := opts.AddressBook.Validate(); err != nil {
+		return err
+	}
+	if err := opts.Fees.Validate(); err != nil {
+		return err
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = newLogger(os.Stdout, opts.LogLevel, opts.LogFormat)
+		slog.SetDefault(logger)
+	}
+	tracer := opts.Tracer
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	metrics := opts.Metrics
+	if opts.MetricsAddr != "" {
+		var stop func()
+		metrics, stop, err = serveMetrics(opts.MetricsAddr, metrics, logger)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	payloadLogger := newPayloadLogger(logger, opts.LogPolicy)
+	rollup := newRollupHttp(opts.RollupURL, payloadLogger, tracer)
+	env := newEnv(ctx, rollup, app, envOpts{
+		book:       opts.AddressBook,
+		appAddress: opts.AppAddress,
+		logger:     payloadLogger,
+		metrics:    metrics,
+		memory:     opts.MeasureMemory,
+		tracer:     tracer,
+		limits:     opts.OutputLimits,
+		fees:       opts.Fees,
+		tokens:     opts.Tokens,
+	})
 	status := finishStatusAccept
+	finishCtx := ctx
 	for {
-		input, err := rollup.finishAndGetNext(ctx, status)
+		input, err := rollup.finishAndGetNext(finishCtx, status)
 		if err != nil {
 			return err
 		}
-		err = env.handle(input)
+		err = env.handle(ctx, input)
+		// link the finish span to the input span, which already ended
+		finishCtx = ContextWithSpanLink(ctx, env.ctx)
 		if err != nil {
 			status = finishStatusReject
 		} else {
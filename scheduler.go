@@ -0,0 +1,137 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"slices"
+	"strings"
+)
+
+// ScheduledAction is an action that runs at the start of an advance input.
+// It receives the env and the metadata of the input.
+// If the action returns an error or panics, Rollmelette rejects the input.
+type ScheduledAction func(env Env, metadata Metadata) error
+
+// scheduledAction is an action in the scheduler queue.
+// The action is due when the block timestamp reaches timestamp, or when the block number
+// reaches blockNumber, depending on which field is set.
+type scheduledAction struct {
+	id          int
+	timestamp   int64
+	blockNumber int64
+	byBlock     bool
+	action      ScheduledAction
+
+	// namespace is the namespace of the mux application that scheduled the action, if any.
+	// The namespaces of nested muxes are joined with "/".
+	namespace string
+}
+
+// due returns whether the action should run in the input with the given metadata.
+func (a *scheduledAction) due(metadata *Metadata) bool {
+	if a.byBlock {
+		return metadata.BlockNumber >= a.blockNumber
+	}
+	return metadata.BlockTimestamp >= a.timestamp
+}
+
+// inNamespace returns whether the action was scheduled by the mux application with the
+// namespace or by an application nested in it.
+func (a *scheduledAction) inNamespace(namespace string) bool {
+	return a.namespace == namespace || strings.HasPrefix(a.namespace, namespace+"/")
+}
+
+// scheduler keeps the queue of scheduled actions.
+// The queue is ordered by the action id, so the actions run in the order they were scheduled.
+type scheduler struct {
+	nextId  int
+	actions []scheduledAction
+}
+
+// schedulerSnapshot contains the state of the scheduler restored on reject.
+type schedulerSnapshot struct {
+	nextId  int
+	actions []scheduledAction
+}
+
+// add adds the action to the queue and returns its id.
+func (s *scheduler) add(action scheduledAction) int {
+	if action.action == nil {
+		panic("nil scheduled action")
+	}
+	action.id = s.nextId
+	s.nextId++
+	s.actions = append(s.actions, action)
+	return action.id
+}
+
+// cancel removes the action from the queue.
+// It returns false if the action isn't in the queue.
+func (s *scheduler) cancel(id int) bool {
+	return s.remove(func(a scheduledAction) bool { return a.id == id })
+}
+
+// cancelIn removes the action from the queue if it was scheduled in the namespace.
+// It returns false if the action isn't in the queue or belongs to another namespace.
+func (s *scheduler) cancelIn(namespace string, id int) bool {
+	return s.remove(func(a scheduledAction) bool { return a.id == id && a.inNamespace(namespace) })
+}
+
+// remove removes the first action that matches the function from the queue.
+// It returns false if no action matches.
+func (s *scheduler) remove(match func(a scheduledAction) bool) bool {
+	i := slices.IndexFunc(s.actions, match)
+	if i < 0 {
+		return false
+	}
+	s.actions = slices.Delete(s.actions, i, i+1)
+	return true
+}
+
+// pending returns the ids of the actions in the queue.
+func (s *scheduler) pending() []int {
+	ids := make([]int, len(s.actions))
+	for i, action := range s.actions {
+		ids[i] = action.id
+	}
+	return ids
+}
+
+// pendingIn returns the ids of the actions in the queue scheduled in the namespace.
+func (s *scheduler) pendingIn(namespace string) []int {
+	ids := []int{}
+	for _, action := range s.actions {
+		if action.inNamespace(namespace) {
+			ids = append(ids, action.id)
+		}
+	}
+	return ids
+}
+
+// popDue removes the due actions from the queue and returns them.
+func (s *scheduler) popDue(metadata *Metadata) []scheduledAction {
+	var due []scheduledAction
+	s.actions = slices.DeleteFunc(s.actions, func(a scheduledAction) bool {
+		if a.due(metadata) {
+			due = append(due, a)
+			return true
+		}
+		return false
+	})
+	return due
+}
+
+// snapshot returns a copy of the scheduler state.
+func (s *scheduler) snapshot() schedulerSnapshot {
+	return schedulerSnapshot{
+		nextId:  s.nextId,
+		actions: slices.Clone(s.actions),
+	}
+}
+
+// restore restores the scheduler state from the snapshot.
+func (s *scheduler) restore(snapshot schedulerSnapshot) {
+	s.nextId = snapshot.nextId
+	s.actions = snapshot.actions
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestSchedulerSuite(t *testing.T) {
+	suite.Run(t, new(SchedulerSuite))
+}
+
+type SchedulerSuite struct {
+	suite.Suite
+	app    *testApplication
+	tester *Tester
+	sender common.Address
+	ran    []string
+}
+
+func (s *SchedulerSuite) SetupTest() {
+	s.app = new(testApplication)
+	s.tester = NewTester(s.app)
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.ran = nil
+}
+
+// record returns an action that records its name.
+func (s *SchedulerSuite) record(name string) ScheduledAction {
+	return func(env Env, metadata Metadata) error {
+		s.ran = append(s.ran, name)
+		return nil
+	}
+}
+
+// advance sends an input that runs the given function in the app.
+func (s *SchedulerSuite) advance(f func(env Env) error) TestAdvanceResult {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		s.ran = append(s.ran, "app")
+		if f == nil {
+			return nil
+		}
+		return f(env)
+	}
+	return s.tester.Advance(s.sender, nil)
+}
+
+func (s *SchedulerSuite) TestTimestamp() {
+	s.tester.SetBlock(1, 1000)
+	result := s.advance(func(env Env) error {
+		env.ScheduleAt(2000, s.record("b"))
+		env.ScheduleAt(1500, s.record("a"))
+		return nil
+	})
+	s.Nil(result.Err)
+
+	s.tester.SetBlock(2, 1499)
+	s.advance(nil)
+	s.Equal([]string{"app", "app"}, s.ran)
+
+	// the due actions run in the order they were scheduled, before the app
+	s.ran = nil
+	s.tester.SetBlock(3, 2000)
+	s.advance(nil)
+	s.Equal([]string{"b", "a", "app"}, s.ran)
+
+	// the actions run only once
+	s.ran = nil
+	s.advance(nil)
+	s.Equal([]string{"app"}, s.ran)
+}
+
+func (s *SchedulerSuite) TestBlockNumber() {
+	s.tester.SetBlock(10, 1000)
+	s.advance(func(env Env) error {
+		env.ScheduleAtBlock(11, s.record("a"))
+		return nil
+	})
+	s.ran = nil
+	s.tester.SetBlock(11, 1000)
+	s.advance(nil)
+	s.Equal([]string{"a", "app"}, s.ran)
+}
+
+func (s *SchedulerSuite) TestCancel() {
+	var id int
+	s.tester.SetBlock(1, 1000)
+	s.advance(func(env Env) error {
+		id = env.ScheduleAt(1000, s.record("a"))
+		env.ScheduleAt(1000, s.record("b"))
+		s.Equal([]int{id, id + 1}, env.ScheduledActions())
+		s.True(env.CancelScheduled(id))
+		s.False(env.CancelScheduled(id))
+		return nil
+	})
+	s.ran = nil
+	s.advance(nil)
+	s.Equal([]string{"b", "app"}, s.ran)
+}
+
+func (s *SchedulerSuite) TestRejectRestoresSchedule() {
+	s.tester.SetBlock(1, 1000)
+	s.advance(func(env Env) error {
+		env.ScheduleAt(1000, func(env Env, metadata Metadata) error {
+			s.ran = append(s.ran, "a")
+			env.SetEtherBalance(s.sender, big.NewInt(10))
+			return nil
+		})
+		return nil
+	})
+
+	// the action runs, but the input is rejected
+	s.ran = nil
+	result := s.advance(func(env Env) error {
+		env.ScheduleAt(1000, s.record("b"))
+		return errors.New("reject")
+	})
+	s.NotNil(result.Err)
+	s.Equal([]string{"a", "app"}, s.ran)
+	s.Equal(big.NewInt(0), s.tester.env.EtherBalanceOf(s.sender))
+
+	// the action runs again, and the action scheduled by the rejected input doesn't exist
+	s.ran = nil
+	result = s.advance(nil)
+	s.Nil(result.Err)
+	s.Equal([]string{"a", "app"}, s.ran)
+	s.Equal(big.NewInt(10), s.tester.env.EtherBalanceOf(s.sender))
+	s.Empty(s.tester.env.ScheduledActions())
+}
+
+func (s *SchedulerSuite) TestPanic() {
+	s.tester.SetBlock(1, 1000)
+	s.advance(func(env Env) error {
+		env.ScheduleAt(1000, func(env Env, metadata Metadata) error {
+			panic("action failed")
+		})
+		return nil
+	})
+	s.ran = nil
+	result := s.advance(nil)
+	s.ErrorContains(result.Err, "action failed")
+	s.Empty(s.ran)
+	s.Len(s.tester.env.ScheduledActions(), 1)
+}
+
+func (s *SchedulerSuite) TestError() {
+	var id int
+	s.tester.SetBlock(1, 1000)
+	s.advance(func(env Env) error {
+		id = env.ScheduleAt(1000, func(env Env, metadata Metadata) error {
+			return env.EtherTransfer(s.sender, common.Address{}, big.NewInt(10))
+		})
+		return nil
+	})
+	s.ran = nil
+	result := s.advance(nil)
+	s.ErrorIs(result.Err, ErrInsufficientFunds)
+	s.ErrorContains(result.Err, fmt.Sprintf("scheduled action %v", id))
+	s.Empty(s.ran)
+	s.Equal([]int{id}, s.tester.env.ScheduledActions())
+}
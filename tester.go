@@ -5,7 +5,9 @@ package rollmelette
 
 import (
 	"context"
+	"log/slog"
 	"math/big"
+	"slices"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -18,7 +20,8 @@ type TestAdvanceResult struct {
 	Notices              []TestNotice
 	Reports              []TestReport
 	Metadata
-	Err error
+	Fees []Fee
+	Err  error
 }
 
 // TestInspectResult
@@ -27,23 +30,109 @@ type TestInspectResult struct {
 	Err     error
 }
 
+// TesterOpts allows the application developer to pass some parameters to the tester.
+type TesterOpts struct {
+	AddressBook
+
+	// AppAddress is the address of the application contract sent in the advance metadata.
+	// If it is empty, the application only learns its address from the address relay.
+	AppAddress common.Address
+
+	// Logger is the logger used by Rollmelette.
+	// If it is nil, the tester uses the default slog logger.
+	Logger *slog.Logger
+
+	// LogPolicy controls how Rollmelette logs the payloads of inputs and outputs.
+	LogPolicy LogPolicy
+
+	// Metrics receives the execution metrics of each input.
+	// If it is nil, the tester doesn't measure the inputs.
+	Metrics MetricsSink
+
+	// MeasureMemory enables the AllocatedBytes metric.
+	MeasureMemory bool
+
+	// Tracer creates the spans of each input.
+	// If it is nil, the tester doesn't trace the inputs.
+	Tracer Tracer
+
+	// OutputLimits limits the outputs of each input.
+	// The tester applies the same limits to the outputs received by the rollup mock.
+	OutputLimits OutputLimits
+
+	// Fees is the fee policy of the wallet operations.
+	Fees FeePolicy
+
+	// Tokens is the registry used to display the ERC20 token amounts.
+	// If it is nil, Rollmelette creates it with the NewTokenRegistry function.
+	Tokens TokenRegistry
+}
+
+// NewTesterOpts creates a TesterOpts struct with sensible default values.
+func NewTesterOpts() *TesterOpts {
+	var opts TesterOpts
+	opts.AddressBook = NewAddressBook()
+	opts.AppAddress = common.HexToAddress("0xab7528bb862fb57e8a2bcd567a2e929a0be56a5e")
+	return &opts
+}
+
 // Tester is an unit tester for the Application.
 type Tester struct {
-	rollup *rollupMock
-	book   AddressBook
-	env    *env
-	index  int
+	rollup     *rollupMock
+	book       AddressBook
+	appAddress common.Address
+	env        *env
+	index      int
+	block      *testBlock
+}
+
+// testBlock is the block set by Tester.SetBlock.
+type testBlock struct {
+	number    int64
+	timestamp int64
 }
 
 // NewTester creates a Tester for the given application
 func NewTester(app Application) *Tester {
-	rollup := &rollupMock{}
-	book := NewAddressBook()
+	return NewTesterWithOpts(app, nil)
+}
+
+// NewTesterWithOpts creates a Tester for the given application with the given options.
+// If opts is nil, this function creates it with the NewTesterOpts function.
+// It panics if the address book or the fee policy is invalid, like the Run function fails.
+func NewTesterWithOpts(app Application, opts *TesterOpts) *Tester {
+	if opts == nil {
+		opts = NewTesterOpts()
+	}
+	if err := opts.AddressBook.Validate(); err != nil {
+		panic(err)
+	}
+	if err := opts.Fees.Validate(); err != nil {
+		panic(err)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	rollup := &rollupMock{limits: opts.OutputLimits}
+	env := newEnv(context.Background(), rollup, app, envOpts{
+		book:       opts.AddressBook,
+		appAddress: opts.AppAddress,
+		logger:     newPayloadLogger(logger, opts.LogPolicy),
+		metrics:    opts.Metrics,
+		memory:     opts.MeasureMemory,
+		tracer:     opts.Tracer,
+		limits:     opts.OutputLimits,
+		fees:       opts.Fees,
+		tokens:     opts.Tokens,
+		rollback:   true,
+	})
 	return &Tester{
-		rollup: rollup,
-		book:   book,
-		env:    newEnv(context.Background(), book, rollup, app),
-		index:  0,
+		rollup:     rollup,
+		book:       opts.AddressBook,
+		appAddress: opts.AppAddress,
+		env:        env,
+		index:      0,
 	}
 }
 
@@ -52,12 +141,48 @@ func (t *Tester) Book() AddressBook {
 	return t.book
 }
 
+// History returns the outputs received across all inputs.
+func (t *Tester) History() TestHistory {
+	return TestHistory{
+		Vouchers:             slices.Clone(t.rollup.history.Vouchers),
+		DelegateCallVouchers: slices.Clone(t.rollup.history.DelegateCallVouchers),
+		Notices:              slices.Clone(t.rollup.history.Notices),
+		Reports:              slices.Clone(t.rollup.history.Reports),
+	}
+}
+
+// SetBlock sets the block number and timestamp of the next advance inputs.
+// By default, the block number is the input index and the block timestamp is the current time.
+func (t *Tester) SetBlock(number int64, timestamp int64) {
+	t.block = &testBlock{number, timestamp}
+}
+
+// InjectFault scripts a failure of the rollup mock for the next inputs.
+// The faults stay injected until ClearFaults is called.
+func (t *Tester) InjectFault(fault TestFault) {
+	t.rollup.inject(fault)
+}
+
+// ClearFaults removes the injected faults.
+func (t *Tester) ClearFaults() {
+	t.rollup.clearFaults()
+}
+
 // Advance sends an advance input to the application.
 // It returns the metadata sent to the app and the outputs received from the app.
 func (t *Tester) Advance(msgSender common.Address, payload []byte) TestAdvanceResult {
 	return t.sendAdvance(msgSender, payload)
 }
 
+// RelayAppAddress simulates an advance input from the application address relay.
+// It panics if the address book doesn't have the address relay.
+func (t *Tester) RelayAppAddress(appAddress common.Address) TestAdvanceResult {
+	if t.book.AppAddressRelay == (common.Address{}) {
+		panic("missing app address relay")
+	}
+	return t.sendAdvance(t.book.AppAddressRelay, appAddress[:])
+}
+
 // DepositEther simulates an advance input from the Ether portal.
 func (t *Tester) DepositEther(
 	msgSender common.Address,
@@ -69,10 +194,7 @@ func (t *Tester) DepositEther(
 	} else if value.Cmp(big.NewInt(0)) < 0 {
 		panic("negative value")
 	}
-	portalPayload := make([]byte, 0, common.AddressLength+common.HashLength+len(payload))
-	portalPayload = append(portalPayload, msgSender[:]...)
-	portalPayload = append(portalPayload, value.FillBytes(make([]byte, common.HashLength))...)
-	portalPayload = append(portalPayload, payload...)
+	portalPayload := t.book.PortalLayout.EncodeEtherDeposit(msgSender, value, payload)
 	return t.sendAdvance(t.env.EtherPortal, portalPayload)
 }
 
@@ -88,22 +210,18 @@ func (t *Tester) DepositERC20(
 	} else if value.Cmp(big.NewInt(0)) < 0 {
 		panic("negative value")
 	}
-	portalPayload := make([]byte, 0, common.AddressLength+2*common.HashLength+len(payload))
-	portalPayload = append(portalPayload, token[:]...)
-	portalPayload = append(portalPayload, msgSender[:]...)
-	portalPayload = append(portalPayload, value.FillBytes(make([]byte, common.HashLength))...)
-	portalPayload = append(portalPayload, payload...)
+	portalPayload := t.book.PortalLayout.EncodeERC20Deposit(token, msgSender, value, payload)
 	return t.sendAdvance(t.env.ERC20Portal, portalPayload)
 }
 
 // Inspect sends an inspect input to the application.
 // It returns the outputs received from the app.
 func (t *Tester) Inspect(payload []byte) TestInspectResult {
-	t.rollup.reset()
+	t.rollup.begin(0)
 	input := inspectInput{
 		Payload: payload,
 	}
-	err := t.env.handle(&input)
+	err := t.handle(&input)
 	return TestInspectResult{
 		Reports: t.rollup.Reports,
 		Err:     err,
@@ -111,21 +229,26 @@ func (t *Tester) Inspect(payload []byte) TestInspectResult {
 }
 
 func (t *Tester) sendAdvance(msgSender common.Address, payload []byte) TestAdvanceResult {
-	t.rollup.reset()
+	t.rollup.begin(t.index)
+	blockNumber, blockTimestamp := int64(t.index), time.Now().Unix()
+	if t.block != nil {
+		blockNumber, blockTimestamp = t.block.number, t.block.timestamp
+	}
 	metadata := Metadata{
 		ChainId:        1,
-		AppContract:    common.HexToAddress("0xab7528bb862fb57e8a2bcd567a2e929a0be56a5e"),
+		AppContract:    t.appAddress,
 		Index:          t.index,
 		MsgSender:      msgSender,
-		BlockNumber:    int64(t.index),
-		BlockTimestamp: time.Now().Unix(),
+		BlockNumber:    blockNumber,
+		BlockTimestamp: blockTimestamp,
 		PrevRandao:     "0x0000000000000000000000000000000000000000000000000000000000000001",
 	}
 	input := advanceInput{
 		Metadata: metadata,
 		Payload:  payload,
 	}
-	err := t.env.handle(&input)
+	err := t.handle(&input)
+	t.rollup.finishAdvance(err == nil)
 	t.index++
 	return TestAdvanceResult{
 		Vouchers:             t.rollup.Vouchers,
@@ -133,6 +256,15 @@ func (t *Tester) sendAdvance(msgSender common.Address, payload []byte) TestAdvan
 		Notices:              t.rollup.Notices,
 		Reports:              t.rollup.Reports,
 		Metadata:             metadata,
+		Fees:                 t.env.collected,
 		Err:                  err,
 	}
 }
+
+// handle sends the input to the env with a context that the rollup mock may cancel.
+func (t *Tester) handle(input any) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.rollup.cancel = cancel
+	return t.env.handle(ctx, input)
+}
@@ -0,0 +1,345 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTesterSuite(t *testing.T) {
+	suite.Run(t, new(TesterSuite))
+}
+
+type TesterSuite struct {
+	suite.Suite
+	app     *testApplication
+	deposit Deposit
+	payload []byte
+	token   common.Address
+	sender  common.Address
+}
+
+func (s *TesterSuite) SetupTest() {
+	s.app = new(testApplication)
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		s.deposit = deposit
+		s.payload = payload
+		return nil
+	}
+	s.deposit = nil
+	s.payload = nil
+	s.token = common.HexToAddress("0xbabababababababababababababababababababa")
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *TesterSuite) newTester(layout PortalLayout) *Tester {
+	opts := NewTesterOpts()
+	opts.PortalLayout = layout
+	return NewTesterWithOpts(s.app, opts)
+}
+
+func (s *TesterSuite) TestDepositEther() {
+	layouts := []PortalLayout{PortalLayoutV2, PortalLayoutV1, PortalLayoutLayerData}
+	for _, layout := range layouts {
+		s.Run(layout.String(), func() {
+			tester := s.newTester(layout)
+			result := tester.DepositEther(s.sender, big.NewInt(100), []byte("deadbeef"))
+			s.Nil(result.Err)
+			s.Equal(&EtherDeposit{s.sender, big.NewInt(100)}, s.deposit)
+			s.Equal([]byte("deadbeef"), s.payload)
+			s.Equal(big.NewInt(100), tester.env.EtherBalanceOf(s.sender))
+		})
+	}
+}
+
+func (s *TesterSuite) TestDepositERC20() {
+	layouts := []PortalLayout{PortalLayoutV2, PortalLayoutV1, PortalLayoutLayerData}
+	for _, layout := range layouts {
+		s.Run(layout.String(), func() {
+			tester := s.newTester(layout)
+			result := tester.DepositERC20(s.token, s.sender, big.NewInt(100), []byte("deadbeef"))
+			s.Nil(result.Err)
+			s.Equal(&ERC20Deposit{s.token, s.sender, big.NewInt(100)}, s.deposit)
+			s.Equal([]byte("deadbeef"), s.payload)
+			s.Equal(big.NewInt(100), tester.env.ERC20BalanceOf(s.token, s.sender))
+		})
+	}
+}
+
+func (s *TesterSuite) TestDepositWithEmptyPayload() {
+	layouts := []PortalLayout{PortalLayoutV2, PortalLayoutV1, PortalLayoutLayerData}
+	for _, layout := range layouts {
+		s.Run(layout.String(), func() {
+			tester := s.newTester(layout)
+			result := tester.DepositERC20(s.token, s.sender, big.NewInt(100), nil)
+			s.Nil(result.Err)
+			s.NotNil(s.deposit)
+			s.Empty(s.payload)
+		})
+	}
+}
+
+func (s *TesterSuite) TestFailedV1ERC20Deposit() {
+	tester := s.newTester(PortalLayoutV1)
+	payload := PortalLayoutV1.EncodeERC20Deposit(s.token, s.sender, big.NewInt(100), nil)
+	payload[0] = 0
+	result := tester.Advance(tester.Book().ERC20Portal, payload)
+	s.ErrorContains(result.Err, "erc20 deposit failed")
+	s.Nil(s.deposit)
+	s.Equal(big.NewInt(0), tester.env.ERC20BalanceOf(s.token, s.sender))
+}
+
+func (s *TesterSuite) TestMalformedLayerData() {
+	tester := s.newTester(PortalLayoutLayerData)
+	payload := PortalLayoutV2.EncodeEtherDeposit(s.sender, big.NewInt(100), []byte("deadbeef"))
+	result := tester.Advance(tester.Book().EtherPortal, payload)
+	s.ErrorContains(result.Err, "invalid eth deposit data")
+	s.Nil(s.deposit)
+}
+
+func (s *TesterSuite) TestSetInvalidBalance() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.SetEtherBalance(s.sender, big.NewInt(100))
+		if len(payload) > 0 {
+			env.SetERC20Balance(s.token, s.sender, big.NewInt(-1))
+		} else {
+			env.SetEtherBalance(s.sender, nil)
+		}
+		return nil
+	}
+	tester := NewTester(s.app)
+	result := tester.Advance(s.sender, nil)
+	s.ErrorIs(result.Err, ErrInvalidValue)
+	result = tester.Advance(s.sender, []byte("erc20"))
+	s.ErrorContains(result.Err, "invalid value: negative value -1")
+	s.Equal(big.NewInt(0), tester.env.EtherBalanceOf(s.sender))
+}
+
+func TestTesterFaultSuite(t *testing.T) {
+	suite.Run(t, new(TesterFaultSuite))
+}
+
+type TesterFaultSuite struct {
+	suite.Suite
+	app     *testApplication
+	tester  *Tester
+	sender  common.Address
+	err     error
+	indices []int
+	errs    []error
+}
+
+func (s *TesterFaultSuite) SetupTest() {
+	s.app = new(testApplication)
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		for i := 0; i < 3; i++ {
+			index, err := env.TryNotice(payload)
+			s.indices = append(s.indices, index)
+			s.errs = append(s.errs, err)
+		}
+		return nil
+	}
+	s.tester = NewTester(s.app)
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	s.err = errors.New("notice failed")
+	s.indices = nil
+	s.errs = nil
+}
+
+func (s *TesterFaultSuite) TestNthCall() {
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Call: 2, Err: s.err})
+	result := s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Equal([]error{nil, s.err, nil}, s.errs)
+	s.Len(result.Notices, 2)
+
+	// the fault only applies to the second call
+	s.errs = nil
+	s.tester.Advance(s.sender, nil)
+	s.Equal([]error{nil, nil, nil}, s.errs)
+}
+
+func (s *TesterFaultSuite) TestIndexGap() {
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Call: 2, IndexGap: 10})
+	result := s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Equal([]int{0, 11, 12}, s.indices)
+}
+
+func (s *TesterFaultSuite) TestDelay() {
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Call: 1, Delay: 10 * time.Millisecond})
+	start := time.Now()
+	result := s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.GreaterOrEqual(time.Since(start), 10*time.Millisecond)
+	s.Len(result.Notices, 3)
+}
+
+func (s *TesterFaultSuite) TestCancel() {
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Call: 2, Cancel: true})
+	result := s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Equal([]error{nil, context.Canceled, context.Canceled}, s.errs)
+
+	// the next input has a new context
+	s.errs = nil
+	s.tester.Advance(s.sender, nil)
+	s.Equal([]error{nil, nil, nil}, s.errs)
+}
+
+func (s *TesterFaultSuite) TestRejectRestoresWallets() {
+	token := common.HexToAddress("0xbabababababababababababababababababababa")
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		if deposit != nil {
+			if string(payload) == "reject" {
+				return s.err
+			}
+			return nil
+		}
+		if _, err := env.EtherWithdraw(s.sender, big.NewInt(40)); err != nil {
+			return err
+		}
+		if err := env.ERC20Transfer(token, s.sender, common.Address{}, big.NewInt(5)); err != nil {
+			return err
+		}
+		env.Notice(payload)
+		return nil
+	}
+	s.Nil(s.tester.DepositEther(s.sender, big.NewInt(100), nil).Err)
+	s.Nil(s.tester.DepositERC20(token, s.sender, big.NewInt(50), nil).Err)
+
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Err: s.err})
+	result := s.tester.Advance(s.sender, nil)
+	s.Equal(s.err, result.Err)
+	s.Equal(big.NewInt(100), s.tester.env.EtherBalanceOf(s.sender))
+	s.Equal(big.NewInt(50), s.tester.env.ERC20BalanceOf(token, s.sender))
+	s.Equal(big.NewInt(0), s.tester.env.ERC20BalanceOf(token, common.Address{}))
+
+	// a rejected deposit is also reverted
+	result = s.tester.DepositEther(s.sender, big.NewInt(100), []byte("reject"))
+	s.Equal(s.err, result.Err)
+	s.Equal(big.NewInt(100), s.tester.env.EtherBalanceOf(s.sender))
+
+	s.tester.ClearFaults()
+	result = s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Equal(big.NewInt(60), s.tester.env.EtherBalanceOf(s.sender))
+	s.Equal(big.NewInt(45), s.tester.env.ERC20BalanceOf(token, s.sender))
+}
+
+func (s *TesterFaultSuite) TestRejectRestoresLocks() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		if deposit != nil {
+			return nil
+		}
+		if err := env.EtherLock(s.sender, big.NewInt(40), "auction"); err != nil {
+			return err
+		}
+		env.Notice(payload)
+		return nil
+	}
+	s.Nil(s.tester.DepositEther(s.sender, big.NewInt(100), nil).Err)
+
+	s.tester.InjectFault(TestFault{Route: LogRouteNotice, Err: s.err})
+	result := s.tester.Advance(s.sender, nil)
+	s.Equal(s.err, result.Err)
+	s.Equal(big.NewInt(100), s.tester.env.EtherAvailableOf(s.sender))
+	s.Empty(s.tester.env.EtherLocks(s.sender))
+
+	s.tester.ClearFaults()
+	result = s.tester.Advance(s.sender, nil)
+	s.Nil(result.Err)
+	s.Equal(big.NewInt(60), s.tester.env.EtherAvailableOf(s.sender))
+	s.Equal(big.NewInt(40), s.tester.env.EtherLockedOf(s.sender))
+}
+
+func TestTesterHistorySuite(t *testing.T) {
+	suite.Run(t, new(TesterHistorySuite))
+}
+
+type TesterHistorySuite struct {
+	suite.Suite
+	app    *testApplication
+	tester *Tester
+	sender common.Address
+}
+
+func (s *TesterHistorySuite) SetupTest() {
+	s.app = new(testApplication)
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Voucher(s.sender, big.NewInt(0), payload)
+		env.Notice(payload)
+		env.Notice(payload)
+		env.Report(payload)
+		if string(payload) == "reject" {
+			return errors.New("rejected")
+		}
+		return nil
+	}
+	s.app.inspect = func(env EnvInspector, payload []byte) error {
+		env.Report(payload)
+		return nil
+	}
+	s.tester = NewTester(s.app)
+	s.sender = common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+}
+
+func (s *TesterHistorySuite) TestCumulativeIndices() {
+	result := s.tester.Advance(s.sender, []byte("first"))
+	s.Nil(result.Err)
+	s.Equal(0, result.Vouchers[0].Index)
+	s.Equal(0, result.Notices[0].Index)
+	s.Equal(1, result.Notices[1].Index)
+
+	result = s.tester.Advance(s.sender, []byte("second"))
+	s.Nil(result.Err)
+	s.Equal(1, result.Vouchers[0].Index)
+	s.Equal(1, result.Vouchers[0].InputIndex)
+	s.Equal(2, result.Notices[0].Index)
+	s.Equal(3, result.Notices[1].Index)
+}
+
+func (s *TesterHistorySuite) TestRejectedInputIndices() {
+	s.tester.Advance(s.sender, []byte("first"))
+	result := s.tester.Advance(s.sender, []byte("reject"))
+	s.NotNil(result.Err)
+	s.Equal(2, result.Notices[0].Index)
+
+	// the indices of the rejected input are reused
+	result = s.tester.Advance(s.sender, []byte("third"))
+	s.Nil(result.Err)
+	s.Equal(1, result.Vouchers[0].Index)
+	s.Equal(2, result.Notices[0].Index)
+}
+
+func (s *TesterHistorySuite) TestHistory() {
+	s.tester.Advance(s.sender, []byte("first"))
+	s.tester.Advance(s.sender, []byte("reject"))
+	s.tester.Inspect([]byte("inspect"))
+	s.tester.Advance(s.sender, []byte("third"))
+
+	history := s.tester.History()
+	s.Equal([]TestVoucher{
+		{Index: 0, InputIndex: 0, Destination: s.sender, Value: big.NewInt(0), Payload: []byte("first")},
+		{Index: 1, InputIndex: 2, Destination: s.sender, Value: big.NewInt(0), Payload: []byte("third")},
+	}, history.Vouchers)
+	s.Equal([]TestNotice{
+		{Index: 0, InputIndex: 0, Payload: []byte("first")},
+		{Index: 1, InputIndex: 0, Payload: []byte("first")},
+		{Index: 2, InputIndex: 2, Payload: []byte("third")},
+		{Index: 3, InputIndex: 2, Payload: []byte("third")},
+	}, history.Notices)
+	s.Equal([]TestReport{
+		{InputIndex: 0, Payload: []byte("first")},
+		{InputIndex: 1, Payload: []byte("reject")},
+		{InputIndex: 2, Payload: []byte("third")},
+	}, history.Reports)
+}
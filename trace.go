@@ -0,0 +1,169 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Span names used by Rollmelette.
+const (
+	SpanInput       = "rollmelette.input"
+	SpanApplication = "rollmelette.application"
+	SpanFinish      = "rollup.finish"
+)
+
+// Tracer creates the spans of the inputs.
+// It follows the OpenTelemetry tracing model, so it may be implemented by an adapter over an
+// OpenTelemetry tracer. Rollmelette creates an input span in Run, a child span for the application
+// handler, and child spans for each call to the Rollup API. The finish span that reports the
+// result of an input is a root span linked to the input span.
+type Tracer interface {
+	// Start starts a span that is a child of the span in the context, if any.
+	// If the context has a link set by ContextWithSpanLink, the new span should be linked to the
+	// span carried by the link context.
+	// It returns a context that carries the new span.
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+type spanLinkKey struct{}
+
+// ContextWithSpanLink returns a context whose next span is linked to the span carried by link.
+func ContextWithSpanLink(ctx context.Context, link context.Context) context.Context {
+	return context.WithValue(ctx, spanLinkKey{}, link)
+}
+
+// SpanLinkFromContext returns the link context set by ContextWithSpanLink, or nil.
+func SpanLinkFromContext(ctx context.Context) context.Context {
+	link, _ := ctx.Value(spanLinkKey{}).(context.Context)
+	return link
+}
+
+// Span is an operation traced by the Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...slog.Attr)
+
+	// SetError marks the span as failed with the given error.
+	SetError(err error)
+
+	// End ends the span.
+	End()
+}
+
+// endSpan sets the error in the span if it isn't nil and ends the span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+// noopTracer ///////////////////////////////////////////////////////////////////////////////////////
+
+// noopTracer is the tracer used when the application doesn't set one.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...slog.Attr) {}
+
+func (noopSpan) SetError(err error) {}
+
+func (noopSpan) End() {}
+
+// MemoryTracer ////////////////////////////////////////////////////////////////////////////////////
+
+// MemorySpan is a span recorded by the MemoryTracer.
+type MemorySpan struct {
+	// ID is the position of the span in the list of recorded spans, starting from one.
+	ID int
+
+	// ParentID is the ID of the parent span, or zero for root spans.
+	ParentID int
+
+	// LinkID is the ID of the linked span, or zero if the span has no link.
+	LinkID int
+
+	Name       string
+	Attributes []slog.Attr
+	Err        error
+	StartTime  time.Time
+	EndTime    time.Time
+	Ended      bool
+}
+
+// MemoryTracer is a tracer that records the spans in memory, which is useful in unit tests.
+type MemoryTracer struct {
+	mutex sync.Mutex
+	spans []*MemorySpan
+}
+
+type memorySpanKey struct{}
+
+func (t *MemoryTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	parentID, _ := ctx.Value(memorySpanKey{}).(int)
+	var linkID int
+	if link := SpanLinkFromContext(ctx); link != nil {
+		linkID, _ = link.Value(memorySpanKey{}).(int)
+		ctx = ContextWithSpanLink(ctx, nil)
+	}
+	span := &MemorySpan{
+		ID:         len(t.spans) + 1,
+		ParentID:   parentID,
+		LinkID:     linkID,
+		Name:       name,
+		Attributes: slices.Clone(attrs),
+		StartTime:  time.Now(),
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, memorySpanKey{}, span.ID), &memorySpanRef{t, span}
+}
+
+// Spans returns a copy of the spans recorded so far, in the order they started.
+func (t *MemoryTracer) Spans() []MemorySpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	spans := make([]MemorySpan, len(t.spans))
+	for i, span := range t.spans {
+		spans[i] = *span
+		spans[i].Attributes = slices.Clone(span.Attributes)
+	}
+	return spans
+}
+
+// memorySpanRef implements the Span interface for the MemoryTracer.
+type memorySpanRef struct {
+	tracer *MemoryTracer
+	span   *MemorySpan
+}
+
+func (r *memorySpanRef) SetAttributes(attrs ...slog.Attr) {
+	r.tracer.mutex.Lock()
+	defer r.tracer.mutex.Unlock()
+	r.span.Attributes = append(r.span.Attributes, attrs...)
+}
+
+func (r *memorySpanRef) SetError(err error) {
+	r.tracer.mutex.Lock()
+	defer r.tracer.mutex.Unlock()
+	r.span.Err = err
+}
+
+func (r *memorySpanRef) End() {
+	r.tracer.mutex.Lock()
+	defer r.tracer.mutex.Unlock()
+	r.span.EndTime = time.Now()
+	r.span.Ended = true
+}
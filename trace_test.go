@@ -0,0 +1,121 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTraceSuite(t *testing.T) {
+	suite.Run(t, new(TraceSuite))
+}
+
+type TraceSuite struct {
+	suite.Suite
+	app    *testApplication
+	tracer *MemoryTracer
+}
+
+func (s *TraceSuite) SetupTest() {
+	s.app = new(testApplication)
+	s.tracer = new(MemoryTracer)
+}
+
+// spanNames returns the names of the spans, with each child indented below its parent.
+func (s *TraceSuite) spanNames() []string {
+	spans := s.tracer.Spans()
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		s.True(span.Ended, span.Name)
+		prefix := ""
+		for parent := span.ParentID; parent != 0; parent = spans[parent-1].ParentID {
+			prefix += "  "
+		}
+		names[i] = prefix + span.Name
+	}
+	return names
+}
+
+func (s *TraceSuite) TestRun() {
+	s.app.advance = func(env Env, metadata Metadata, deposit Deposit, payload []byte) error {
+		env.Notice(payload)
+		env.Report(payload)
+		return fmt.Errorf("reject")
+	}
+	var finishes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/finish":
+			finishes++
+			switch finishes {
+			case 1:
+				w.WriteHeader(http.StatusAccepted)
+			case 2:
+				fmt.Fprint(w, `{"request_type":"advance_state","data":{"payload":"0xdeadbeef",`+
+					`"metadata":{"msg_sender":"0xfafafafafafafafafafafafafafafafafafafafa","index":0}}}`)
+			default:
+				var request struct{ Status string }
+				s.Nil(json.Unmarshal(body, &request))
+				s.Equal("reject", request.Status)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case "/notice":
+			fmt.Fprint(w, `{"index":0}`)
+		case "/report":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	opts := NewRunOpts()
+	opts.RollupURL = server.URL
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	opts.Tracer = s.tracer
+	err := Run(context.Background(), opts, s.app)
+	s.ErrorContains(err, "invalid status 500")
+
+	s.Equal([]string{
+		SpanFinish,
+		SpanInput,
+		"  " + SpanApplication,
+		"    rollup.notice",
+		"    rollup.report",
+		SpanFinish,
+	}, s.spanNames())
+
+	spans := s.tracer.Spans()
+	input := spans[1]
+	s.Equal(SpanInput, input.Name)
+	s.Contains(input.Attributes, slog.String("route", LogRouteAdvance))
+	s.ErrorContains(input.Err, "reject")
+	s.Equal(slog.Int("payloadSize", 4), spans[3].Attributes[0])
+	s.ErrorContains(spans[5].Err, "invalid status 500")
+	s.Zero(spans[0].LinkID)
+	s.Equal(input.ID, spans[5].LinkID)
+}
+
+func (s *TraceSuite) TestTester() {
+	s.app.inspect = func(env EnvInspector, payload []byte) error {
+		env.Report(payload)
+		return nil
+	}
+	opts := NewTesterOpts()
+	opts.Tracer = s.tracer
+	tester := NewTesterWithOpts(s.app, opts)
+	result := tester.Inspect(nil)
+	s.Nil(result.Err)
+	s.Equal([]string{SpanInput, "  " + SpanApplication}, s.spanNames())
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EtherDecimals is the number of decimals of Ether.
+const EtherDecimals = 18
+
+// FormatUnits formats the integer value as a decimal number with the given decimals.
+// For instance, it formats 1500000000000000000 with 18 decimals as "1.5".
+// It omits the trailing zeros of the fractional part, and the point if the value is whole.
+func FormatUnits(value *big.Int, decimals uint8) string {
+	digits := new(big.Int).Abs(value).String()
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(decimals)
+	str := digits[:point]
+	if fraction := strings.TrimRight(digits[point:], "0"); fraction != "" {
+		str += "." + fraction
+	}
+	if value.Sign() < 0 {
+		str = "-" + str
+	}
+	return str
+}
+
+// ParseUnits parses the decimal number and returns the integer value with the given decimals.
+// For instance, it parses "1.5" with 18 decimals as 1500000000000000000.
+// It returns an error wrapping ErrInvalidValue if the string isn't a decimal number or if it
+// has more fractional digits than decimals.
+func ParseUnits(str string, decimals uint8) (*big.Int, error) {
+	digits := strings.TrimPrefix(str, "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" {
+		return nil, fmt.Errorf("%w: can't parse %q", ErrInvalidValue, str)
+	}
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("%w: %q has more than %v decimals", ErrInvalidValue, str, decimals)
+	}
+	digits = whole + fraction + strings.Repeat("0", int(decimals)-len(fraction))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("%w: can't parse %q", ErrInvalidValue, str)
+		}
+	}
+	value, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(str, "-") {
+		value.Neg(value)
+	}
+	return value, nil
+}
+
+// TokenInfo describes how to display the amounts of an ERC20 token.
+type TokenInfo struct {
+	// Symbol is the symbol of the token, such as "USDC".
+	Symbol string
+
+	// Decimals is the number of decimals of the token.
+	Decimals uint8
+}
+
+// TokenRegistry maps ERC20 token addresses to their symbols and decimals.
+// Rollmelette uses it to display the token amounts of the deposits; the tokens that aren't
+// in the registry are displayed as raw integers.
+type TokenRegistry map[common.Address]TokenInfo
+
+// defaultTokenRegistry is the registry of the default address book.
+var defaultTokenRegistry = NewTokenRegistry(NewAddressBook())
+
+// NewTokenRegistry creates a registry with the test token of the address book, if there is one.
+func NewTokenRegistry(book AddressBook) TokenRegistry {
+	registry := make(TokenRegistry)
+	if book.TestToken != (common.Address{}) {
+		registry[book.TestToken] = TokenInfo{Symbol: "TEST", Decimals: 18}
+	}
+	return registry
+}
+
+// Format formats the amount of the token with its symbol, such as "1.5 USDC".
+// If the token isn't in the registry, it formats the amount as a raw integer followed by the
+// token address.
+func (r TokenRegistry) Format(token common.Address, value *big.Int) string {
+	info, ok := r[token]
+	if !ok {
+		return fmt.Sprintf("%v of %v token", value, token)
+	}
+	return fmt.Sprintf("%v %v", FormatUnits(value, info.Decimals), info.Symbol)
+}
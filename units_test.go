@@ -0,0 +1,79 @@
+// Copyright (c) Gabriel de Quadros Ligneul
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package rollmelette
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestUnitsSuite(t *testing.T) {
+	suite.Run(t, new(UnitsSuite))
+}
+
+type UnitsSuite struct {
+	suite.Suite
+}
+
+func (s *UnitsSuite) TestFormatUnits() {
+	s.Equal("1.5", FormatUnits(big.NewInt(1500000000000000000), 18))
+	s.Equal("0.000000000000000001", FormatUnits(big.NewInt(1), 18))
+	s.Equal("0", FormatUnits(big.NewInt(0), 18))
+	s.Equal("12", FormatUnits(big.NewInt(1200), 2))
+	s.Equal("-0.05", FormatUnits(big.NewInt(-5), 2))
+	s.Equal("123", FormatUnits(big.NewInt(123), 0))
+}
+
+func (s *UnitsSuite) TestParseUnits() {
+	for str, expected := range map[string]*big.Int{
+		"1.5":                  big.NewInt(1500000000000000000),
+		"0.000000000000000001": big.NewInt(1),
+		"2":                    big.NewInt(2000000000000000000),
+		".5":                   big.NewInt(500000000000000000),
+		"-1.":                  big.NewInt(-1000000000000000000),
+	} {
+		value, err := ParseUnits(str, 18)
+		s.Nil(err, str)
+		s.Equal(expected, value, str)
+	}
+
+	for _, str := range []string{"", ".", "-", "1.2.3", "1e18", "+1", "0x10", "1.0000000000000000001"} {
+		_, err := ParseUnits(str, 18)
+		s.ErrorIs(err, ErrInvalidValue, str)
+	}
+}
+
+func (s *UnitsSuite) TestRoundTrip() {
+	value, ok := new(big.Int).SetString("123456789012345678901234567890", 10)
+	s.Require().True(ok)
+	parsed, err := ParseUnits(FormatUnits(value, 6), 6)
+	s.Nil(err)
+	s.Equal(value, parsed)
+}
+
+func (s *UnitsSuite) TestRegistryDeposit() {
+	var deposit Deposit
+	app := &testApplication{
+		advance: func(env Env, metadata Metadata, d Deposit, payload []byte) error {
+			deposit = d
+			return nil
+		},
+	}
+	tester := NewTester(app)
+	sender := common.HexToAddress("0xfafafafafafafafafafafafafafafafafafafafa")
+	value := big.NewInt(2500000000000000000)
+	s.Nil(tester.DepositERC20(tester.Book().TestToken, sender, value, nil).Err)
+	s.Equal("0xFafafAfafAFaFAFaFafafafAfaFaFAfAfAfAFaFA deposited 2.5 TEST", deposit.String())
+	s.Equal(deposit.String(), tester.env.formatDeposit(deposit))
+
+	// the logs use the registry of the options
+	opts := NewTesterOpts()
+	opts.Tokens = TokenRegistry{}
+	tester = NewTesterWithOpts(app, opts)
+	s.Nil(tester.DepositERC20(tester.Book().TestToken, sender, value, nil).Err)
+	s.Contains(tester.env.formatDeposit(deposit), "deposited 2500000000000000000 of ")
+}